@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/shivamhw/content-pirate/commons"
+	"github.com/shivamhw/content-pirate/pkg/imghash"
+	"github.com/shivamhw/content-pirate/pkg/log"
+	"github.com/spf13/cobra"
+)
+
+func dupesCmd() *cobra.Command {
+	var dir, algo string
+	var dist int
+	cmd := &cobra.Command{
+		Use:   "dupes",
+		Short: "lists clusters of near identical images in a download dir",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a := imghash.Algo(algo)
+			if !a.Valid() {
+				return fmt.Errorf("unknown image hash %s", algo)
+			}
+			root, err := filepath.Abs(dir)
+			if err != nil {
+				return err
+			}
+			x, err := imghash.OpenIndex(a, imghash.IndexFile(root, a))
+			if err != nil {
+				return err
+			}
+			entries, err := hashDir(root, x)
+			if err != nil {
+				return err
+			}
+			clusters := imghash.Clusters(entries, dist)
+			for n, c := range clusters {
+				fmt.Printf("cluster %d\n", n+1)
+				for _, e := range c {
+					fmt.Printf("\t%s\t%s\n", e.Hash, e.Path)
+				}
+			}
+			fmt.Printf("%d images, %d clusters of near duplicates\n", len(entries), len(clusters))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&dir, "dir", "./download", "dir of a file store")
+	cmd.Flags().StringVar(&algo, "algo", string(imghash.DHash), "image hash: dhash, phash")
+	cmd.Flags().IntVar(&dist, "distance", 5, "max differing bits for images to be near duplicates")
+	return cmd
+}
+
+// hashDir returns hashes of every image under root, hashes missing in the
+// index are computed and added to it
+func hashDir(root string, x *imghash.Index) (entries []imghash.Entry, err error) {
+	known := x.Entries()
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !slices.Contains(commons.IMG_SUFFIX, strings.ToLower(filepath.Ext(path))) {
+			return nil
+		}
+		if e, ok := known[path]; ok {
+			entries = append(entries, e)
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h, err := imghash.Compute(x.Algo(), f)
+		if err != nil {
+			log.Warnf("skipping image", "path", path, "err", err)
+			return nil
+		}
+		if err := x.Add(path, h); err != nil {
+			return err
+		}
+		entries = append(entries, imghash.Entry{Path: path, Hash: h})
+		return nil
+	})
+	return entries, err
+}
@@ -1,8 +1,10 @@
 package reddit_cmd
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/shivamhw/content-pirate/pkg/reddit"
 	"github.com/shivamhw/content-pirate/pkg/scrapper"
@@ -15,6 +17,7 @@ var (
 	sCfg       scrapper.ScrapeCfg
 	scrapeOpts sources.ScrapeOpts
 	dst        store.FileDstPath
+	dstUris    []string
 	ids        []string
 )
 
@@ -31,6 +34,19 @@ func scrapeCmd() *cobra.Command {
 				return err
 			}
 			scrapeOpts.RedditFilter = f1
+			dsts, err := store.ParseDsts(dstUris)
+			if err != nil {
+				return err
+			}
+			for n, d := range dsts {
+				if f, ok := d.(store.FileDstPath); ok {
+					dsts[n] = withFileFlags(cmd, f)
+				}
+			}
+			// --dir is the dst unless other dsts are given
+			if len(dsts) == 0 || cmd.Flags().Changed("dir") {
+				dsts = append(dsts, dst)
+			}
 			sCfg.SourceType = sources.SOURCE_TYPE_REDDIT
 			s, err := scrapper.NewScrapper(&sCfg)
 			if err != nil {
@@ -40,7 +56,8 @@ func scrapeCmd() *cobra.Command {
 			for _, i := range ids {
 				j := scrapper.Job{
 					SrcAc:       i,
-					Dst:         []store.DstPath{dst},
+					SourceType:  sources.SOURCE_TYPE_REDDIT,
+					Dst:         dsts,
 					Opts:        scrapeOpts,
 				}
 
@@ -58,26 +75,60 @@ func scrapeCmd() *cobra.Command {
 				for _, f := range j.I {
 					fmt.Printf("%s\t%s\n", f.SourceAc, f.Dst)
 				}
+				failed, _ := s.GetFailedItems(i)
+				for _, f := range failed {
+					fmt.Printf("FAILED\t%s\t%s\t%s\n", f.SourceAc, f.Src, f.Err)
+				}
 			}
-			return err
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(sCfg.TimeOut)*time.Second)
+			defer cancel()
+			return s.Stop(ctx)
 		},
 	}
 	cmd.Flags().StringVar(&dst.BasePath, "dir", "./download", "dst folder for downloads")
+	cmd.Flags().StringArrayVar(&dstUris, "dst", nil, "dst uri, repeatable: file:///path, telegram://<chatId>?phone=, s3://<bucket>/<prefix>?endpoint=, webdav[s]://<host>/<path>, archive:///path")
+	cmd.Flags().BoolVar(&dst.Sidecar, "sidecar", false, "write metadata of every file to <file>.json, applies to file dsts")
+	cmd.Flags().BoolVar(&dst.Index, "index", false, "append metadata of every file to index.jsonl of its source, applies to file dsts")
+	cmd.Flags().StringVar(&dst.PathFormat, "path-format", "", "go template of file path under a file dst, e.g. {{.SourceAc}}/{{.Date.Format \"2006-01\"}}/{{.Id}}.{{.Ext}}")
 	cmd.Flags().StringVar(&sCfg.AuthCfg, "auth", "./reddit.json", "auth config for reddit")
 	cmd.Flags().StringVar(&scrapeOpts.Duration, "duration", "day", "duration")
 	cmd.Flags().IntVar(&scrapeOpts.Limit, "limit", 25, "limit")
-	cmd.Flags().StringSliceVar(&ids, "source", []string{}, "source channel ids")
+	cmd.Flags().StringSliceVar(&ids, "source", []string{}, "sources: subreddit, u/<user> for submissions of a user, me/saved or me/upvoted of the account in --auth")
 	cmd.Flags().BoolVar(&scrapeOpts.SkipVideos, "skip-vid", true, "skip video download")
 	cmd.Flags().BoolVar(&scrapeOpts.SkipCollection, "skip-collection", false, "download full collection")
-	cmd.Flags().BoolVar(&dst.Clean, "cleanOnStart", false, "clean folders")
+	cmd.Flags().BoolVar(&dst.Clean, "cleanOnStart", false, "clean folders of file dsts")
 	cmd.Flags().IntVar(&sCfg.ImgWorkers, "img-worker", 10, "nof img proccesing worker")
 	cmd.Flags().IntVar(&sCfg.VidWorkers, "vid-worker", 5, "nof vid proccesing worker")
 	cmd.Flags().Int64Var(&sCfg.TimeOut, "time-out", 60, "timeout in seconds")
 	cmd.Flags().IntVar(&sCfg.TopicWorkers, "reddit-worker", 15, "nof reddit proccesing worker")
 	cmd.Flags().StringVar(&filter, "filter", "TOP", "filter: NEW, HOT, TOP")
+	cmd.Flags().IntVar(&sCfg.Retry.MaxAttempts, "retries", 3, "max download attempts per item")
+	cmd.Flags().DurationVar(&sCfg.Retry.Backoff, "retry-backoff", 2*time.Second, "wait before retrying an item, doubles every attempt")
+	cmd.Flags().StringVar(&sCfg.KvPath, "state", "", "bolt file to persist task state, in memory if empty")
+	cmd.Flags().StringVar((*string)(&sCfg.Dedupe), "dedupe", "skip", "action for content already in a store: skip, hardlink, alias, off")
+	cmd.Flags().StringVar((*string)(&sCfg.NearDupe.Algo), "near-dupe", "", "image hash to skip near identical images: dhash, phash, off if empty")
+	cmd.Flags().IntVar(&sCfg.NearDupe.Distance, "near-dupe-distance", 5, "max differing bits for images to be near duplicates")
 	return cmd
 }
 
+// withFileFlags applies file flags given on the cli to a file dst of --dst,
+// they override query params of the uri
+func withFileFlags(cmd *cobra.Command, d store.FileDstPath) store.FileDstPath {
+	f := cmd.Flags()
+	if f.Changed("sidecar") {
+		d.Sidecar = dst.Sidecar
+	}
+	if f.Changed("index") {
+		d.Index = dst.Index
+	}
+	if f.Changed("path-format") {
+		d.PathFormat = dst.PathFormat
+	}
+	if f.Changed("cleanOnStart") {
+		d.Clean = dst.Clean
+	}
+	return d
+}
 
 func sanitizeFilter(f *string) (reddit.PostFilter, error) {
 	filter := strings.ToUpper(fmt.Sprintf("REDDIT_%s", *f))
@@ -26,6 +26,8 @@ func init() {
 	rootCmd.AddCommand(helloCmd)
 	rootCmd.AddCommand(reddit_cmd.RedditCmd())
 	rootCmd.AddCommand(telegram_cmd.TelegramCmd())
+	rootCmd.AddCommand(serveCmd())
+	rootCmd.AddCommand(dupesCmd())
 
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
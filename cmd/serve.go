@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/shivamhw/content-pirate/pkg/log"
+	"github.com/shivamhw/content-pirate/pkg/scrapper"
+	"github.com/shivamhw/content-pirate/pkg/server"
+	"github.com/shivamhw/content-pirate/sources"
+	"github.com/spf13/cobra"
+)
+
+func serveCmd() *cobra.Command {
+	var sCfg scrapper.ScrapeCfg
+	var addr, src string
+	var opts server.ServerOpts
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "runs scrapper with a http api to submit and track jobs",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.Token == "" {
+				opts.Token = os.Getenv("CONTENT_PIRATE_TOKEN")
+			}
+			if opts.Token == "" && !isLoopback(addr) {
+				return fmt.Errorf("a token is required to serve on %s, pass --token or set CONTENT_PIRATE_TOKEN", addr)
+			}
+			if opts.Root != "" {
+				if err := os.MkdirAll(opts.Root, 0755); err != nil {
+					return err
+				}
+			}
+			sCfg.SourceType = sources.SourceType(fmt.Sprintf("SOURCE_TYPE_%s", strings.ToUpper(src)))
+			s, err := scrapper.NewScrapper(&sCfg)
+			if err != nil {
+				return err
+			}
+			srv, err := server.NewServer(s, opts)
+			if err != nil {
+				return err
+			}
+			log.SetId(s.Id)
+			go s.Start()
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			h := &http.Server{
+				Addr:    addr,
+				Handler: srv,
+			}
+			go func() {
+				<-ctx.Done()
+				sCtx, cancel := context.WithTimeout(context.Background(), time.Duration(sCfg.TimeOut)*time.Second)
+				defer cancel()
+				h.Shutdown(sCtx)
+			}()
+			log.Infof("serving api", "addr", addr)
+			if err := h.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			sCtx, cancel := context.WithTimeout(context.Background(), time.Duration(sCfg.TimeOut)*time.Second)
+			defer cancel()
+			return s.Stop(sCtx)
+		},
+	}
+	cmd.Flags().StringVar(&addr, "addr", "127.0.0.1:8080", "listen address, other than loopback needs a token")
+	cmd.Flags().StringVar(&opts.Token, "token", "", "bearer token for the api, CONTENT_PIRATE_TOKEN if empty")
+	cmd.Flags().StringVar(&opts.Root, "root", "./download", "dir local dsts of jobs are confined to")
+	cmd.Flags().StringVar(&src, "source", "reddit", "source: reddit, telegram")
+	cmd.Flags().StringVar(&sCfg.AuthCfg, "auth", "./reddit.json", "auth config for reddit")
+	cmd.Flags().StringVar(&sCfg.PhoneNumber, "phone", "", "phone nm for telegram")
+	cmd.Flags().StringVar(&sCfg.KvPath, "state", "./state.db", "bolt file to persist task state, in memory if empty")
+	cmd.Flags().IntVar(&sCfg.ImgWorkers, "img-worker", 10, "nof img proccesing worker")
+	cmd.Flags().IntVar(&sCfg.VidWorkers, "vid-worker", 5, "nof vid proccesing worker")
+	cmd.Flags().IntVar(&sCfg.TopicWorkers, "topic-worker", 15, "nof source proccesing worker")
+	cmd.Flags().Int64Var(&sCfg.TimeOut, "time-out", 60, "timeout in seconds")
+	cmd.Flags().IntVar(&sCfg.Retry.MaxAttempts, "retries", 3, "max download attempts per item")
+	cmd.Flags().StringVar((*string)(&sCfg.Dedupe), "dedupe", "skip", "action for content already in a store: skip, hardlink, alias, off")
+	cmd.Flags().StringVar((*string)(&sCfg.NearDupe.Algo), "near-dupe", "", "image hash to skip near identical images: dhash, phash, off if empty")
+	cmd.Flags().IntVar(&sCfg.NearDupe.Distance, "near-dupe-distance", 5, "max differing bits for images to be near duplicates")
+	return cmd
+}
+
+// isLoopback is true if addr only listens on the loopback interface
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -1,7 +1,11 @@
 package telegram_cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
 	"time"
 
 	"github.com/shivamhw/content-pirate/pkg/log"
@@ -14,7 +18,8 @@ import (
 var (
 	sCfg       scrapper.ScrapeCfg
 	scrapeOpts sources.ScrapeOpts
-	dst        store.TelegramDstPath
+	dstUris    []string
+	dstPhone   string
 	ids        []string
 )
 
@@ -28,22 +33,29 @@ func scrapeCmd() *cobra.Command {
 		Short: "scrapes chats",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ids = UniqueStrings(ids)
+			// bad dsts fail before workers and kv of the scrapper are started
+			dsts, err := parseDsts(dstUris)
+			if err != nil {
+				return err
+			}
 			sCfg.SourceType = sources.SOURCE_TYPE_TELEGRAM
 			s, err := scrapper.NewScrapper(&sCfg)
 			if err != nil {
 				return err
 			}
 			log.SetId(s.Id)
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
 			go s.Start()
 			scrapeOpts.LastFrom = time.Now().Add(time.Duration(-timeDelta) * time.Minute)
-			dst.PhoneNumber = sCfg.PhoneNumber
 			count := 0
 			for {
 				fmt.Println("sent msg", count)
 				for _, i := range ids {
 					j := scrapper.Job{
 						SrcAc: i,
-						Dst:   []store.DstPath{dst},
+						SourceType: sources.SOURCE_TYPE_TELEGRAM,
+						Dst:   dsts,
 						Opts:  scrapeOpts,
 					}
 
@@ -54,7 +66,13 @@ func scrapeCmd() *cobra.Command {
 					jIds = append(jIds, id)
 				}
 				fmt.Println("waiting...")
-				time.Sleep(time.Duration(waitTime) * time.Minute)
+				select {
+				case <-ctx.Done():
+					sCtx, cancel := context.WithTimeout(context.Background(), time.Duration(sCfg.TimeOut)*time.Second)
+					defer cancel()
+					return s.Stop(sCtx)
+				case <-time.After(time.Duration(waitTime) * time.Minute):
+				}
 				count = 0
 				for _, i := range jIds {
 					j, _ := s.GetJob(i)
@@ -73,10 +91,42 @@ func scrapeCmd() *cobra.Command {
 	cmd.Flags().StringVar(&sCfg.PhoneNumber, "phone", "", "phone nm for telegram")
 	cmd.Flags().IntVar(&timeDelta, "last", 60, "last msgs from x minutes")
 	cmd.Flags().IntVar(&waitTime, "wait", 1, "wait in x minutes")
-	cmd.Flags().IntVar(&dst.ChatId, "dst", 0, "dst channel id")
+	cmd.Flags().StringArrayVar(&dstUris, "dst", nil, "dst channel id or uri, repeatable: telegram://<chatId>?phone=, file:///path, s3://<bucket>/<prefix>?endpoint=, webdav[s]://<host>/<path>")
+	cmd.Flags().StringVar(&dstPhone, "dst-phone", "", "phone nm of telegram account to post to telegram dsts, --phone if empty")
+	cmd.Flags().StringVar(&sCfg.KvPath, "state", "", "bolt file to persist task state, in memory if empty")
+	cmd.Flags().StringVar((*string)(&sCfg.Dedupe), "dedupe", "skip", "action for content already in a store: skip, hardlink, alias, off")
+	cmd.Flags().StringVar((*string)(&sCfg.NearDupe.Algo), "near-dupe", "", "image hash to skip near identical images: dhash, phash, off if empty")
+	cmd.Flags().IntVar(&sCfg.NearDupe.Distance, "near-dupe-distance", 5, "max differing bits for images to be near duplicates")
 	return cmd
 }
 
+// parseDsts parses dst uris, bare chat ids are telegram dsts which post
+// with --dst-phone
+func parseDsts(uris []string) ([]store.DstPath, error) {
+	if len(uris) == 0 {
+		return nil, fmt.Errorf("at least one --dst is required")
+	}
+	if dstPhone == "" {
+		dstPhone = sCfg.PhoneNumber
+	}
+	var dsts []store.DstPath
+	for _, uri := range uris {
+		if _, err := strconv.Atoi(uri); err == nil {
+			uri = "telegram://" + uri
+		}
+		d, err := store.ParseDst(uri)
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := d.(store.TelegramDstPath); ok && t.PhoneNumber == "" {
+			t.PhoneNumber = dstPhone
+			d = t
+		}
+		dsts = append(dsts, d)
+	}
+	return dsts, nil
+}
+
 func UniqueStrings(input []string) []string {
 	seen := make(map[string]struct{})
 	var result []string
@@ -2,6 +2,10 @@ package commons
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
 )
 
 type ItemStatus string
@@ -10,6 +14,8 @@ const (
 	FAILED  ItemStatus = "FAILED"
 	SUCCESS ItemStatus = "SUCCESS"
 	STARTED ItemStatus = "STARTED"
+	PENDING ItemStatus = "PENDING"
+	CANCELLED ItemStatus = "CANCELLED"
 )
 
 type Item struct {
@@ -22,12 +28,43 @@ type Item struct {
 	SourceAc string
 	Ext      string
 	Title    string
+	Author   string
+	Date     time.Time // creation time of the post
+	Score    int
+	Permalink string
+	Meta     map[string]string // source specific metadata
+	Attempts int
+	Err      string
+	GroupId   string // items of one gallery post share group id
+	GroupSize int
+	GroupIdx  int
+	Size     int64
+	Hash     string // sha256 of content
+	ImgHash  string // perceptual hash of images when near dupe detection is on
+	AliasOf  string // path of same content in store, set by alias dedupe
+	Dupes    int    // stores which already had the content
 	Ctx      context.Context `json:"-"`
-	Data     []byte   `json:"-"`
+	Path     string `json:"-"` // local file holding downloaded content
+}
+
+// Open returns reader over downloaded content of item, each store opens its
+// own reader so one download feeds many stores
+func (i *Item) Open() (io.ReadCloser, error) {
+	if i.Path == "" {
+		return nil, fmt.Errorf("item %s is not downloaded", i.Id)
+	}
+	return os.Open(i.Path)
 }
 
 type ItemUpdateOpts struct {
 	Dst      string
 	Status   ItemStatus
 	FileName string
+	Attempts int
+	Err      string
+	Size     int64
+	Hash     string
+	ImgHash  string
+	AliasOf  string
+	Dupes    int
 }
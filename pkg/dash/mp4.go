@@ -0,0 +1,634 @@
+package dash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// ErrUnsupported is returned by Mux before anything is written when inputs
+// can't be muxed, callers can fall back to the video alone
+var ErrUnsupported = errors.New("unsupported mp4 input")
+
+var be = binary.BigEndian
+
+// containers are the boxes Mux descends into, every other box is copied as is
+var containers = map[string]bool{
+	"moov": true, "trak": true, "mdia": true, "minf": true, "stbl": true,
+	"edts": true, "mvex": true, "moof": true, "traf": true,
+}
+
+// box is a box of an input file
+type box struct {
+	typ  string
+	off  int64
+	hdr  int64
+	size int64
+}
+
+func (b box) end() int64 {
+	return b.off + b.size
+}
+
+// readBoxes lists boxes in r between off and end
+func readBoxes(r io.ReaderAt, off, end int64) ([]box, error) {
+	var boxes []box
+	hdr := make([]byte, 16)
+	for off+8 <= end {
+		if _, err := r.ReadAt(hdr[:8], off); err != nil {
+			return nil, err
+		}
+		b := box{typ: string(hdr[4:8]), off: off, hdr: 8, size: int64(be.Uint32(hdr))}
+		switch b.size {
+		case 0:
+			b.size = end - off
+		case 1:
+			if _, err := r.ReadAt(hdr[8:16], off+8); err != nil {
+				return nil, err
+			}
+			b.hdr, b.size = 16, int64(be.Uint64(hdr[8:16]))
+		}
+		if b.size < b.hdr || b.end() > end {
+			return nil, fmt.Errorf("%w: box %q at %d overflows file", ErrUnsupported, b.typ, off)
+		}
+		boxes = append(boxes, b)
+		off = b.end()
+	}
+	return boxes, nil
+}
+
+func readBox(r io.ReaderAt, b box) ([]byte, error) {
+	data := make([]byte, b.size)
+	_, err := r.ReadAt(data, b.off)
+	return data, err
+}
+
+// mkBox is a box of typ with payload
+func mkBox(typ string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+	b := make([]byte, 8, size)
+	be.PutUint32(b, uint32(size))
+	copy(b[4:], typ)
+	for _, p := range payload {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// rewrite rebuilds box b, fn is called with every leaf box and returns its
+// replacement, nil drops the box
+func rewrite(b []byte, fn func(typ string, b []byte) ([]byte, error)) ([]byte, error) {
+	typ, _, err := header(b)
+	if err != nil {
+		return nil, err
+	}
+	if !containers[typ] {
+		return fn(typ, b)
+	}
+	children, err := children(b)
+	if err != nil {
+		return nil, err
+	}
+	var payload [][]byte
+	for _, c := range children {
+		c, err = rewrite(c, fn)
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			payload = append(payload, c)
+		}
+	}
+	return mkBox(typ, payload...), nil
+}
+
+func header(b []byte) (typ string, hdr int, err error) {
+	if len(b) < 8 {
+		return "", 0, fmt.Errorf("%w: short box", ErrUnsupported)
+	}
+	typ, hdr = string(b[4:8]), 8
+	if be.Uint32(b) == 1 {
+		hdr = 16
+	}
+	return typ, hdr, nil
+}
+
+// children splits payload of container b into its boxes
+func children(b []byte) ([][]byte, error) {
+	_, hdr, err := header(b)
+	if err != nil {
+		return nil, err
+	}
+	boxes, err := readBoxes(bytes.NewReader(b), int64(hdr), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+	res := make([][]byte, len(boxes))
+	for n, c := range boxes {
+		res[n] = b[c.off:c.end()]
+	}
+	return res, nil
+}
+
+// find returns first box at path under container b
+func find(b []byte, path ...string) []byte {
+	for _, typ := range path {
+		cs, err := children(b)
+		if err != nil {
+			return nil
+		}
+		b = nil
+		for _, c := range cs {
+			if string(c[4:8]) == typ {
+				b = c
+				break
+			}
+		}
+		if b == nil {
+			return nil
+		}
+	}
+	return b
+}
+
+// fullBox returns version and payload after the version and flags of b
+func fullBox(b []byte) (version byte, p []byte, err error) {
+	_, hdr, err := header(b)
+	if err != nil || len(b) < hdr+4 {
+		return 0, nil, fmt.Errorf("%w: short full box", ErrUnsupported)
+	}
+	return b[hdr], b[hdr+4:], nil
+}
+
+// input is one mp4 stream with a single track
+type input struct {
+	r              *io.SectionReader
+	ftyp           []byte
+	mvhd           []byte
+	trak           []byte
+	mvex           []byte
+	movieTimescale uint32
+	mediaTimescale uint32
+	frags          []fragment
+	data           [2]int64 // progressive inputs, range of mdat payloads
+}
+
+// fragment is a moof of an input followed by its data
+type fragment struct {
+	in      *input
+	moof    []byte
+	moofOff int64
+	data    [2]int64
+	time    float64 // decode time in seconds
+}
+
+func (in *input) fragmented() bool {
+	return in.mvex != nil
+}
+
+func parseInput(r *io.SectionReader) (*input, error) {
+	boxes, err := readBoxes(r, 0, r.Size())
+	if err != nil {
+		return nil, err
+	}
+	in := &input{r: r, data: [2]int64{-1, -1}}
+	var frag *fragment
+	for _, b := range boxes {
+		switch b.typ {
+		case "ftyp":
+			if in.ftyp, err = readBox(r, b); err != nil {
+				return nil, err
+			}
+		case "moov":
+			moov, err := readBox(r, b)
+			if err != nil {
+				return nil, err
+			}
+			if err := in.parseMoov(moov); err != nil {
+				return nil, err
+			}
+		case "moof":
+			moof, err := readBox(r, b)
+			if err != nil {
+				return nil, err
+			}
+			in.frags = append(in.frags, fragment{in: in, moof: moof, moofOff: b.off, data: [2]int64{b.end(), b.end()}})
+			frag = &in.frags[len(in.frags)-1]
+		case "mdat":
+			if frag != nil {
+				frag.data[1] = b.end()
+				continue
+			}
+			if in.data[0] < 0 {
+				in.data[0] = b.off + b.hdr
+			}
+			in.data[1] = b.end()
+		}
+	}
+	if in.trak == nil {
+		return nil, fmt.Errorf("%w: no track found", ErrUnsupported)
+	}
+	if in.fragmented() {
+		in.fragTimes()
+	} else if in.data[0] < 0 {
+		return nil, fmt.Errorf("%w: no media data found", ErrUnsupported)
+	}
+	return in, nil
+}
+
+func (in *input) parseMoov(moov []byte) error {
+	cs, err := children(moov)
+	if err != nil {
+		return err
+	}
+	for _, c := range cs {
+		switch string(c[4:8]) {
+		case "mvhd":
+			in.mvhd = c
+		case "trak":
+			if in.trak == nil {
+				in.trak = c
+			}
+		case "mvex":
+			in.mvex = c
+		}
+	}
+	if in.mvhd == nil || in.trak == nil {
+		return fmt.Errorf("%w: moov without mvhd or trak", ErrUnsupported)
+	}
+	if in.movieTimescale, err = timescale(in.mvhd); err != nil {
+		return err
+	}
+	mdhd := find(in.trak, "mdia", "mdhd")
+	if mdhd == nil {
+		return fmt.Errorf("%w: track without mdhd", ErrUnsupported)
+	}
+	in.mediaTimescale, err = timescale(mdhd)
+	return err
+}
+
+// timescale of a mvhd or mdhd
+func timescale(b []byte) (uint32, error) {
+	v, p, err := fullBox(b)
+	if err != nil {
+		return 0, err
+	}
+	off := 8
+	if v == 1 {
+		off = 16
+	}
+	if len(p) < off+4 || be.Uint32(p[off:]) == 0 {
+		return 0, fmt.Errorf("%w: bad timescale", ErrUnsupported)
+	}
+	return be.Uint32(p[off:]), nil
+}
+
+// fragTimes sets decode time of fragments from tfdt, fragments without it
+// keep time of the previous one
+func (in *input) fragTimes() {
+	prev := 0.0
+	for n := range in.frags {
+		f := &in.frags[n]
+		f.time = prev
+		tfdt := find(f.moof, "traf", "tfdt")
+		if tfdt == nil {
+			continue
+		}
+		v, p, err := fullBox(tfdt)
+		if err != nil {
+			continue
+		}
+		switch {
+		case v == 1 && len(p) >= 8:
+			f.time = float64(be.Uint64(p)) / float64(in.mediaTimescale)
+		case len(p) >= 4:
+			f.time = float64(be.Uint32(p)) / float64(in.mediaTimescale)
+		}
+		prev = f.time
+	}
+}
+
+// Mux writes an mp4 with the video track of video and the audio track of
+// audio to w. Both inputs must be fragmented, as DASH streams are, or both
+// progressive. Inputs are validated before anything is written, errors
+// wrapping ErrUnsupported mean w is untouched.
+func Mux(w io.Writer, video, audio *io.SectionReader) error {
+	v, err := parseInput(video)
+	if err != nil {
+		return fmt.Errorf("video: %w", err)
+	}
+	a, err := parseInput(audio)
+	if err != nil {
+		return fmt.Errorf("audio: %w", err)
+	}
+	if v.fragmented() != a.fragmented() {
+		return fmt.Errorf("%w: fragmented and progressive inputs", ErrUnsupported)
+	}
+	if v.fragmented() {
+		return muxFragmented(w, v, a)
+	}
+	return muxProgressive(w, v, a)
+}
+
+func muxFragmented(w io.Writer, v, a *input) error {
+	moov, err := buildMoov(v, a, nil)
+	if err != nil {
+		return err
+	}
+	frags := append(append([]fragment{}, v.frags...), a.frags...)
+	sort.SliceStable(frags, func(i, j int) bool {
+		return frags[i].time < frags[j].time
+	})
+	// every moof is rewritten before writing so errors leave w untouched
+	moofs := make([][]byte, len(frags))
+	off := int64(len(v.ftyp) + len(moov))
+	for n, f := range frags {
+		id := uint32(1)
+		if f.in == a {
+			id = 2
+		}
+		if moofs[n], err = rewriteMoof(f.moof, uint32(n+1), id, off-f.moofOff); err != nil {
+			return err
+		}
+		if len(moofs[n]) != len(f.moof) {
+			return fmt.Errorf("%w: moof changed size", ErrUnsupported)
+		}
+		off += int64(len(f.moof)) + f.data[1] - f.data[0]
+	}
+	if _, err := w.Write(v.ftyp); err != nil {
+		return err
+	}
+	if _, err := w.Write(moov); err != nil {
+		return err
+	}
+	for n, f := range frags {
+		if _, err := w.Write(moofs[n]); err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, io.NewSectionReader(f.in.r, f.data[0], f.data[1]-f.data[0])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteMoof sets sequence number and track id of moof, explicit base data
+// offsets are moved by shift
+func rewriteMoof(moof []byte, seq, id uint32, shift int64) ([]byte, error) {
+	return rewrite(moof, func(typ string, b []byte) ([]byte, error) {
+		if typ != "mfhd" && typ != "tfhd" {
+			return b, nil
+		}
+		_, p, err := fullBox(b)
+		if err != nil {
+			return nil, err
+		}
+		b = append([]byte{}, b...)
+		p = b[len(b)-len(p):]
+		switch typ {
+		case "mfhd":
+			if len(p) < 4 {
+				return nil, fmt.Errorf("%w: short mfhd", ErrUnsupported)
+			}
+			be.PutUint32(p, seq)
+		case "tfhd":
+			if len(p) < 4 {
+				return nil, fmt.Errorf("%w: short tfhd", ErrUnsupported)
+			}
+			be.PutUint32(p, id)
+			flags := be.Uint32(b[len(b)-len(p)-4:]) & 0xffffff
+			if flags&1 != 0 {
+				if len(p) < 12 {
+					return nil, fmt.Errorf("%w: short tfhd", ErrUnsupported)
+				}
+				be.PutUint64(p[4:], uint64(int64(be.Uint64(p[4:]))+shift))
+			}
+		}
+		return b, nil
+	})
+}
+
+func muxProgressive(w io.Writer, v, a *input) error {
+	vLen, aLen := v.data[1]-v.data[0], a.data[1]-a.data[0]
+	mdatHdr := int64(8)
+	if vLen+aLen+8 > math.MaxUint32 {
+		mdatHdr = 16
+	}
+	// chunk offsets don't change size of moov, so it is built twice: once
+	// for its size and once with final offsets
+	moov, err := buildMoov(v, a, map[*input]int64{v: 0, a: 0})
+	if err != nil {
+		return err
+	}
+	start := int64(len(v.ftyp)+len(moov)) + mdatHdr
+	moov, err = buildMoov(v, a, map[*input]int64{v: start - v.data[0], a: start + vLen - a.data[0]})
+	if err != nil {
+		return err
+	}
+	hdr := make([]byte, mdatHdr)
+	if mdatHdr == 16 {
+		be.PutUint32(hdr, 1)
+		copy(hdr[4:], "mdat")
+		be.PutUint64(hdr[8:], uint64(vLen+aLen+16))
+	} else {
+		be.PutUint32(hdr, uint32(vLen+aLen+8))
+		copy(hdr[4:], "mdat")
+	}
+	for _, b := range [][]byte{v.ftyp, moov, hdr} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	for _, in := range []*input{v, a} {
+		if _, err := io.Copy(w, io.NewSectionReader(in.r, in.data[0], in.data[1]-in.data[0])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildMoov is a moov with track of v as 1 and track of a as 2, durations of
+// a are moved to timescale of v. shifts move chunk offsets of progressive
+// inputs.
+func buildMoov(v, a *input, shifts map[*input]int64) ([]byte, error) {
+	vTrak, err := rewriteTrak(v, 1, v.movieTimescale, shifts[v])
+	if err != nil {
+		return nil, err
+	}
+	aTrak, err := rewriteTrak(a, 2, v.movieTimescale, shifts[a])
+	if err != nil {
+		return nil, err
+	}
+	mvhd := append([]byte{}, v.mvhd...)
+	if len(mvhd) < 12 {
+		return nil, fmt.Errorf("%w: short mvhd", ErrUnsupported)
+	}
+	be.PutUint32(mvhd[len(mvhd)-4:], 3)
+	if !v.fragmented() {
+		if err := maxDuration(mvhd, a.mvhd, a.movieTimescale, v.movieTimescale); err != nil {
+			return nil, err
+		}
+	}
+	payload := [][]byte{mvhd, vTrak, aTrak}
+	if v.fragmented() {
+		mvex, err := buildMvex(v, a)
+		if err != nil {
+			return nil, err
+		}
+		payload = append(payload, mvex)
+	}
+	return mkBox("moov", payload...), nil
+}
+
+func buildMvex(v, a *input) ([]byte, error) {
+	var payload [][]byte
+	if mehd := find(v.mvex, "mehd"); mehd != nil {
+		payload = append(payload, mehd)
+	}
+	for id, in := range []*input{v, a} {
+		trex := find(in.mvex, "trex")
+		if trex == nil {
+			return nil, fmt.Errorf("%w: mvex without trex", ErrUnsupported)
+		}
+		trex = append([]byte{}, trex...)
+		_, p, err := fullBox(trex)
+		if err != nil || len(p) < 4 {
+			return nil, fmt.Errorf("%w: short trex", ErrUnsupported)
+		}
+		be.PutUint32(trex[len(trex)-len(p):], uint32(id+1))
+		payload = append(payload, trex)
+	}
+	return mkBox("mvex", payload...), nil
+}
+
+// rewriteTrak sets track id, moves movie durations from timescale of in to
+// ts and chunk offsets by shift
+func rewriteTrak(in *input, id, ts uint32, shift int64) ([]byte, error) {
+	return rewrite(in.trak, func(typ string, b []byte) ([]byte, error) {
+		switch typ {
+		case "tkhd", "elst", "stco", "co64":
+		default:
+			return b, nil
+		}
+		b = append([]byte{}, b...)
+		v, p, err := fullBox(b)
+		if err != nil {
+			return nil, err
+		}
+		p = b[len(b)-len(p):]
+		short := fmt.Errorf("%w: short %s", ErrUnsupported, typ)
+		switch typ {
+		case "tkhd":
+			idOff, durOff, wide := 8, 16, false
+			if v == 1 {
+				idOff, durOff, wide = 16, 24, true
+			}
+			if len(p) < durOff+8 {
+				return nil, short
+			}
+			be.PutUint32(p[idOff:], id)
+			rescaleAt(p[durOff:], wide, in.movieTimescale, ts)
+		case "elst":
+			if len(p) < 4 {
+				return nil, short
+			}
+			n, size, wide := int(be.Uint32(p)), 12, v == 1
+			if wide {
+				size = 20
+			}
+			if len(p) < 4+n*size {
+				return nil, short
+			}
+			for e := range n {
+				rescaleAt(p[4+e*size:], wide, in.movieTimescale, ts)
+			}
+		case "stco", "co64":
+			if len(p) < 4 {
+				return nil, short
+			}
+			n, size := int(be.Uint32(p)), 4
+			if typ == "co64" {
+				size = 8
+			}
+			if len(p) < 4+n*size {
+				return nil, short
+			}
+			for e := range n {
+				at := p[4+e*size:]
+				if size == 8 {
+					be.PutUint64(at, uint64(int64(be.Uint64(at))+shift))
+					continue
+				}
+				off := int64(be.Uint32(at)) + shift
+				if off < 0 || off > math.MaxUint32 {
+					return nil, fmt.Errorf("%w: chunk offset out of range of stco", ErrUnsupported)
+				}
+				be.PutUint32(at, uint32(off))
+			}
+		}
+		return b, nil
+	})
+}
+
+// rescaleAt moves duration at b from timescale from to to, all ones mean
+// unknown and are kept
+func rescaleAt(b []byte, wide bool, from, to uint32) {
+	if from == to {
+		return
+	}
+	if wide {
+		if d := be.Uint64(b); d != math.MaxUint64 {
+			be.PutUint64(b, d*uint64(to)/uint64(from))
+		}
+		return
+	}
+	if d := be.Uint32(b); d != math.MaxUint32 {
+		be.PutUint32(b, uint32(uint64(d)*uint64(to)/uint64(from)))
+	}
+}
+
+// maxDuration sets duration of mvhd to the longer of its own and of other
+func maxDuration(mvhd, other []byte, otherTs, ts uint32) error {
+	v, p, err := fullBox(mvhd)
+	if err != nil {
+		return err
+	}
+	ov, op, err := fullBox(other)
+	if err != nil {
+		return err
+	}
+	p = mvhd[len(mvhd)-len(p):]
+	dur := func(v byte, p []byte) (uint64, error) {
+		if v == 1 && len(p) >= 28 {
+			return be.Uint64(p[20:]), nil
+		}
+		if v == 0 && len(p) >= 16 {
+			return uint64(be.Uint32(p[12:])), nil
+		}
+		return 0, fmt.Errorf("%w: short mvhd", ErrUnsupported)
+	}
+	d, err := dur(v, p)
+	if err != nil {
+		return err
+	}
+	od, err := dur(ov, op)
+	if err != nil {
+		return err
+	}
+	if od = od * uint64(ts) / uint64(otherTs); od <= d {
+		return nil
+	}
+	if v == 1 {
+		be.PutUint64(p[20:], od)
+	} else if od <= math.MaxUint32 {
+		be.PutUint32(p[12:], uint32(od))
+	}
+	return nil
+}
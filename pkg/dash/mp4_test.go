@@ -0,0 +1,172 @@
+package dash
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func u32(v uint32) []byte {
+	return be.AppendUint32(nil, v)
+}
+
+func u64(v uint64) []byte {
+	return be.AppendUint64(nil, v)
+}
+
+// fb is payload of a full box
+func fb(version byte, flags uint32, p ...[]byte) []byte {
+	b := u32(uint32(version)<<24 | flags)
+	for _, v := range p {
+		b = append(b, v...)
+	}
+	return b
+}
+
+func testMoov(id, movieTs, mediaTs, dur uint32, stbl []byte, fragmented bool) []byte {
+	mvhd := mkBox("mvhd", fb(0, 0, make([]byte, 8), u32(movieTs), u32(dur), make([]byte, 76), u32(id+1)))
+	tkhd := mkBox("tkhd", fb(0, 0, make([]byte, 8), u32(id), make([]byte, 4), u32(dur), make([]byte, 60)))
+	mdhd := mkBox("mdhd", fb(0, 0, make([]byte, 8), u32(mediaTs), u32(0), make([]byte, 4)))
+	minf := mkBox("minf")
+	if stbl != nil {
+		minf = mkBox("minf", stbl)
+	}
+	trak := mkBox("trak", tkhd, mkBox("mdia", mdhd, minf))
+	if !fragmented {
+		return mkBox("moov", mvhd, trak)
+	}
+	mvex := mkBox("mvex", mkBox("trex", fb(0, 0, u32(id), make([]byte, 16))))
+	return mkBox("moov", mvhd, trak, mvex)
+}
+
+// fragmentedInput has a fragment with data for every decode time in times
+func fragmentedInput(id, ts uint32, times []uint64, data []string) *io.SectionReader {
+	b := append(mkBox("ftyp", []byte("iso6\x00\x00\x00\x00iso6")), testMoov(id, 1000, ts, 0, nil, true)...)
+	for n, t := range times {
+		moof := mkBox("moof",
+			mkBox("mfhd", fb(0, 0, u32(uint32(n+1)))),
+			mkBox("traf",
+				mkBox("tfhd", fb(0, 0x020000, u32(id))),
+				mkBox("tfdt", fb(1, 0, u64(t)))))
+		b = append(b, moof...)
+		b = append(b, mkBox("mdat", []byte(data[n]))...)
+	}
+	return io.NewSectionReader(bytes.NewReader(b), 0, int64(len(b)))
+}
+
+// progressiveInput has chunks in one mdat before moov
+func progressiveInput(id, movieTs, dur uint32, chunks []string) *io.SectionReader {
+	ftyp := mkBox("ftyp", []byte("isom\x00\x00\x00\x00isom"))
+	var payload []byte
+	var offsets []byte
+	start := len(ftyp) + 8
+	for _, c := range chunks {
+		offsets = append(offsets, u32(uint32(start+len(payload)))...)
+		payload = append(payload, c...)
+	}
+	stbl := mkBox("stbl", mkBox("stco", fb(0, 0, u32(uint32(len(chunks))), offsets)))
+	b := append(ftyp, mkBox("mdat", payload)...)
+	b = append(b, testMoov(id, movieTs, 1000, dur, stbl, false)...)
+	return io.NewSectionReader(bytes.NewReader(b), 0, int64(len(b)))
+}
+
+func topBox(t *testing.T, b []byte, typ string) []byte {
+	boxes, err := readBoxes(bytes.NewReader(b), 0, int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, box := range boxes {
+		if box.typ == typ {
+			return b[box.off:box.end()]
+		}
+	}
+	t.Fatalf("no %s box", typ)
+	return nil
+}
+
+func trackId(t *testing.T, trak []byte) uint32 {
+	_, p, err := fullBox(find(trak, "tkhd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return be.Uint32(p[8:])
+}
+
+func TestMuxFragmented(t *testing.T) {
+	video := fragmentedInput(7, 90000, []uint64{0, 180000}, []string{"V0", "V1"})
+	audio := fragmentedInput(1, 48000, []uint64{0, 48000, 96000}, []string{"A0", "A1", "A2"})
+	var out bytes.Buffer
+	if err := Mux(&out, video, audio); err != nil {
+		t.Fatal(err)
+	}
+	in, err := parseInput(io.NewSectionReader(bytes.NewReader(out.Bytes()), 0, int64(out.Len())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	moov := topBox(t, out.Bytes(), "moov")
+	traks, _ := children(moov)
+	if len(traks) != 4 || trackId(t, traks[1]) != 1 || trackId(t, traks[2]) != 2 {
+		t.Fatalf("expected mvhd, 2 traks and mvex in moov")
+	}
+	want := []struct {
+		id   uint32
+		data string
+	}{{1, "V0"}, {2, "A0"}, {2, "A1"}, {1, "V1"}, {2, "A2"}}
+	if len(in.frags) != len(want) {
+		t.Fatalf("expected %d fragments, found %d", len(want), len(in.frags))
+	}
+	for n, f := range in.frags {
+		_, mfhd, _ := fullBox(find(f.moof, "mfhd"))
+		_, tfhd, _ := fullBox(find(f.moof, "traf", "tfhd"))
+		data := make([]byte, f.data[1]-f.data[0]-8)
+		in.r.ReadAt(data, f.data[0]+8)
+		if be.Uint32(mfhd) != uint32(n+1) || be.Uint32(tfhd) != want[n].id || string(data) != want[n].data {
+			t.Fatalf("fragment %d: seq %d track %d data %s, expected track %d data %s",
+				n, be.Uint32(mfhd), be.Uint32(tfhd), data, want[n].id, want[n].data)
+		}
+	}
+}
+
+func TestMuxProgressive(t *testing.T) {
+	video := progressiveInput(1, 600, 1200, []string{"vvvv", "VVVV"})
+	audio := progressiveInput(1, 1000, 2500, []string{"aa", "AA", "aA"})
+	var out bytes.Buffer
+	if err := Mux(&out, video, audio); err != nil {
+		t.Fatal(err)
+	}
+	b := out.Bytes()
+	moov := topBox(t, b, "moov")
+	wants := [][]string{{"vvvv", "VVVV"}, {"aa", "AA", "aA"}}
+	for n, want := range wants {
+		trak := find(moov, "trak")
+		if n == 1 {
+			cs, _ := children(moov)
+			trak = cs[2]
+		}
+		if trackId(t, trak) != uint32(n+1) {
+			t.Fatalf("expected track %d", n+1)
+		}
+		_, stco, _ := fullBox(find(trak, "mdia", "minf", "stbl", "stco"))
+		for c, chunk := range want {
+			off := be.Uint32(stco[4+c*4:])
+			if got := string(b[off : int(off)+len(chunk)]); got != chunk {
+				t.Fatalf("track %d chunk %d: expected %s, found %s", n+1, c, chunk, got)
+			}
+		}
+	}
+	// audio of 2.5s is longer than video of 2s, duration is in video timescale
+	_, mvhd, _ := fullBox(find(moov, "mvhd"))
+	if d := be.Uint32(mvhd[12:]); d != 1500 {
+		t.Fatalf("expected duration 1500, found %d", d)
+	}
+}
+
+func TestMuxMixedInputs(t *testing.T) {
+	video := fragmentedInput(1, 90000, []uint64{0}, []string{"V0"})
+	audio := progressiveInput(1, 1000, 1000, []string{"aa"})
+	var out bytes.Buffer
+	if err := Mux(&out, video, audio); !errors.Is(err, ErrUnsupported) || out.Len() != 0 {
+		t.Fatalf("expected ErrUnsupported and nothing written, found %v and %d bytes", err, out.Len())
+	}
+}
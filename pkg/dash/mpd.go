@@ -0,0 +1,126 @@
+// Package dash picks streams of a DASH manifest and remuxes separate video
+// and audio mp4 streams into one mp4
+package dash
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// MPD is the part of a DASH manifest needed to pick progressive streams,
+// segment templates are not supported
+type MPD struct {
+	BaseURL string   `xml:"BaseURL"`
+	Periods []period `xml:"Period"`
+}
+
+type period struct {
+	BaseURL string          `xml:"BaseURL"`
+	Sets    []adaptationSet `xml:"AdaptationSet"`
+}
+
+type adaptationSet struct {
+	ContentType string           `xml:"contentType,attr"`
+	MimeType    string           `xml:"mimeType,attr"`
+	BaseURL     string           `xml:"BaseURL"`
+	Reps        []Representation `xml:"Representation"`
+}
+
+type Representation struct {
+	Id        string `xml:"id,attr"`
+	MimeType  string `xml:"mimeType,attr"`
+	Codecs    string `xml:"codecs,attr"`
+	Bandwidth int    `xml:"bandwidth,attr"`
+	Width     int    `xml:"width,attr"`
+	Height    int    `xml:"height,attr"`
+	BaseURL   string `xml:"BaseURL"`
+	URL       string `xml:"-"` // BaseURL resolved against the manifest
+}
+
+func ParseMPD(r io.Reader) (*MPD, error) {
+	var m MPD
+	if err := xml.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("parsing dash manifest failed %w", err)
+	}
+	return &m, nil
+}
+
+// Best returns representations of first period with highest bandwidth of
+// video and of audio, urls are resolved against manifest url. audio is nil
+// for silent videos.
+func (m *MPD) Best(manifest string) (video, audio *Representation, err error) {
+	base, err := url.Parse(manifest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(m.Periods) == 0 {
+		return nil, nil, fmt.Errorf("dash manifest %s has no period", manifest)
+	}
+	p := m.Periods[0]
+	for _, s := range p.Sets {
+		for n := range s.Reps {
+			rep := s.Reps[n]
+			u, err := resolve(base, m.BaseURL, p.BaseURL, s.BaseURL, rep.BaseURL)
+			if err != nil {
+				return nil, nil, err
+			}
+			if u == manifest {
+				// no BaseURL, segment templates are not supported
+				continue
+			}
+			rep.URL = u
+			switch kind(s, rep) {
+			case "video":
+				if better(&rep, video) {
+					video = &rep
+				}
+			case "audio":
+				if better(&rep, audio) {
+					audio = &rep
+				}
+			}
+		}
+	}
+	if video == nil {
+		return nil, nil, fmt.Errorf("dash manifest %s has no video stream", manifest)
+	}
+	return video, audio, nil
+}
+
+func resolve(base *url.URL, refs ...string) (string, error) {
+	u := base
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+		r, err := url.Parse(ref)
+		if err != nil {
+			return "", err
+		}
+		u = u.ResolveReference(r)
+	}
+	return u.String(), nil
+}
+
+func kind(s adaptationSet, rep Representation) string {
+	for _, v := range []string{s.ContentType, rep.MimeType, s.MimeType} {
+		if k, _, _ := strings.Cut(v, "/"); k == "video" || k == "audio" {
+			return k
+		}
+	}
+	return ""
+}
+
+func better(a, b *Representation) bool {
+	if b == nil {
+		return true
+	}
+	if a.Bandwidth != b.Bandwidth {
+		return a.Bandwidth > b.Bandwidth
+	}
+	return a.Height > b.Height
+}
@@ -0,0 +1,52 @@
+package dash
+
+import (
+	"strings"
+	"testing"
+)
+
+// manifest as served by v.redd.it
+const redditMPD = `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" mediaPresentationDuration="PT12.5S" minBufferTime="PT1.5S" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static">
+  <Period duration="PT12.5S">
+    <AdaptationSet contentType="video" id="0" maxFrameRate="30" maxHeight="720" maxWidth="1280" par="16:9" segmentAlignment="true" subsegmentAlignment="true">
+      <Representation bandwidth="1200000" codecs="avc1.4d401f" frameRate="30" height="480" id="VIDEO-1" mimeType="video/mp4" width="854">
+        <BaseURL>DASH_480.mp4</BaseURL>
+        <SegmentBase indexRange="817-912" timescale="15360"><Initialization range="0-816"/></SegmentBase>
+      </Representation>
+      <Representation bandwidth="2400000" codecs="avc1.4d401f" frameRate="30" height="720" id="VIDEO-2" mimeType="video/mp4" width="1280">
+        <BaseURL>DASH_720.mp4</BaseURL>
+        <SegmentBase indexRange="817-912" timescale="15360"><Initialization range="0-816"/></SegmentBase>
+      </Representation>
+    </AdaptationSet>
+    <AdaptationSet contentType="audio" id="1" segmentAlignment="true" subsegmentAlignment="true">
+      <Representation audioSamplingRate="48000" bandwidth="64000" codecs="mp4a.40.2" id="AUDIO-1" mimeType="audio/mp4">
+        <BaseURL>DASH_AUDIO_64.mp4</BaseURL>
+      </Representation>
+      <Representation audioSamplingRate="48000" bandwidth="128000" codecs="mp4a.40.2" id="AUDIO-2" mimeType="audio/mp4">
+        <BaseURL>DASH_AUDIO_128.mp4</BaseURL>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+func TestBest(t *testing.T) {
+	m, err := ParseMPD(strings.NewReader(redditMPD))
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, audio, err := m.Best("https://v.redd.it/abc/DASHPlaylist.mpd?a=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.URL != "https://v.redd.it/abc/DASH_720.mp4" || audio == nil || audio.URL != "https://v.redd.it/abc/DASH_AUDIO_128.mp4" {
+		t.Fatalf("unexpected streams %+v %+v", video, audio)
+	}
+
+	silent := strings.Replace(redditMPD, `contentType="audio"`, `contentType="text"`, 1)
+	silent = strings.ReplaceAll(silent, `mimeType="audio/mp4"`, `mimeType="text/vtt"`)
+	m, _ = ParseMPD(strings.NewReader(silent))
+	if _, audio, err = m.Best("https://v.redd.it/abc/DASHPlaylist.mpd"); err != nil || audio != nil {
+		t.Fatalf("expected no audio, found %+v %v", audio, err)
+	}
+}
@@ -0,0 +1,168 @@
+package imghash
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"math/bits"
+	"slices"
+	"strconv"
+)
+
+// Algo is a perceptual hash algorithm
+type Algo string
+
+const (
+	DHash Algo = "dhash" // difference of adjacent pixels, fast
+	PHash Algo = "phash" // low frequencies of dct, survives re-encoding better
+)
+
+// Hash is a 64 bit perceptual hash, near identical images have hashes with
+// small hamming distance
+type Hash uint64
+
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+func ParseHash(s string) (Hash, error) {
+	v, err := strconv.ParseUint(s, 16, 64)
+	return Hash(v), err
+}
+
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+func (h *Hash) UnmarshalText(b []byte) (err error) {
+	*h, err = ParseHash(string(b))
+	return err
+}
+
+// Distance is the number of bits which differ in a and b
+func Distance(a, b Hash) int {
+	return bits.OnesCount64(uint64(a ^ b))
+}
+
+func (a Algo) Valid() bool {
+	return a == DHash || a == PHash
+}
+
+// Compute decodes jpeg, png or gif from r and hashes it with algo
+func Compute(algo Algo, r io.Reader) (Hash, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return 0, err
+	}
+	return Of(algo, img)
+}
+
+func Of(algo Algo, img image.Image) (Hash, error) {
+	switch algo {
+	case DHash:
+		return dHash(img), nil
+	case PHash:
+		return pHash(img), nil
+	}
+	return 0, fmt.Errorf("unknown hash algo %s", algo)
+}
+
+// dHash compares each pixel with its right neighbour on a 9x8 thumbnail
+func dHash(img image.Image) Hash {
+	px := gray(img, 9, 8)
+	var h Hash
+	for y := range 8 {
+		for x := range 8 {
+			h <<= 1
+			if px[y*9+x] < px[y*9+x+1] {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+// pHash compares the 8x8 lowest frequencies of dct of a 32x32 thumbnail with
+// their median
+func pHash(img image.Image) Hash {
+	const n = 32
+	px := gray(img, n, n)
+	coef := dct(px, n)
+	var low [64]float64
+	for y := range 8 {
+		for x := range 8 {
+			low[y*8+x] = coef[y*n+x]
+		}
+	}
+	// dc term carries brightness only, it is left out of the median
+	ac := slices.Clone(low[1:])
+	slices.Sort(ac)
+	median := ac[len(ac)/2]
+	var h Hash
+	for _, v := range low {
+		h <<= 1
+		if v > median {
+			h |= 1
+		}
+	}
+	return h
+}
+
+// gray scales img down to w x h luminance values by averaging source
+// pixels of each cell
+func gray(img image.Image, w, h int) []float64 {
+	b := img.Bounds()
+	out := make([]float64, w*h)
+	for y := range h {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := max(b.Min.Y+(y+1)*b.Dy()/h, y0+1)
+		for x := range w {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := max(b.Min.X+(x+1)*b.Dx()/w, x0+1)
+			var sum float64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					r, g, bl, _ := img.At(sx, sy).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)
+				}
+			}
+			out[y*w+x] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+	return out
+}
+
+// dct is a 2d type II dct of the n x n matrix px
+func dct(px []float64, n int) []float64 {
+	cos := make([]float64, n*n)
+	for k := range n {
+		for i := range n {
+			cos[k*n+i] = math.Cos(math.Pi / float64(n) * (float64(i) + 0.5) * float64(k))
+		}
+	}
+	rows := make([]float64, n*n)
+	for y := range n {
+		for k := range n {
+			var s float64
+			for i := range n {
+				s += px[y*n+i] * cos[k*n+i]
+			}
+			rows[y*n+k] = s
+		}
+	}
+	out := make([]float64, n*n)
+	for x := range n {
+		for k := range n {
+			var s float64
+			for i := range n {
+				s += rows[i*n+x] * cos[k*n+i]
+			}
+			out[k*n+x] = s
+		}
+	}
+	return out
+}
@@ -0,0 +1,104 @@
+package imghash
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"path/filepath"
+	"testing"
+)
+
+// pattern draws blocks of varying brightness so hashes have structure
+func pattern(w, h int, invert bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			v := uint8((x*7/w)*30 + (y*5/h)*20)
+			if invert {
+				v = 255 - v
+			}
+			img.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+func reencode(t *testing.T, img image.Image) image.Image {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 40}); err != nil {
+		t.Fatal(err)
+	}
+	out, _, err := image.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestNearDuplicates(t *testing.T) {
+	for _, algo := range []Algo{DHash, PHash} {
+		orig, _ := Of(algo, pattern(640, 480, false))
+		resized, _ := Of(algo, reencode(t, pattern(320, 240, false)))
+		other, _ := Of(algo, pattern(640, 480, true))
+		if d := Distance(orig, resized); d > 6 {
+			t.Errorf("%s: resized copy is %d bits away", algo, d)
+		}
+		if d := Distance(orig, other); d < 20 {
+			t.Errorf("%s: different image is only %d bits away", algo, d)
+		}
+	}
+}
+
+func TestIndexPersist(t *testing.T) {
+	file := IndexFile(t.TempDir(), DHash)
+	x, err := OpenIndex(DHash, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.Add("a.jpg", 0xff00)
+	x.Add("b.jpg", 0xff01)
+	x.Add("c.jpg", 0x00ff)
+
+	x, err = OpenIndex(DHash, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := x.Nearest(0xff03, 2); !ok || e.Path != "b.jpg" {
+		t.Fatalf("expected b.jpg as nearest, found %+v", e)
+	}
+	var entries []Entry
+	for _, e := range x.Entries() {
+		entries = append(entries, e)
+	}
+	c := Clusters(entries, 1)
+	if len(c) != 1 || len(c[0]) != 2 {
+		t.Fatalf("expected one cluster of a and b, found %+v", c)
+	}
+	if filepath.Base(file) != ".dhash.jsonl" {
+		t.Fatalf("unexpected index file %s", file)
+	}
+}
+
+func TestIndexRemove(t *testing.T) {
+	file := IndexFile(t.TempDir(), DHash)
+	x, err := OpenIndex(DHash, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.Add("a.jpg", 0xff00)
+	x.Add("b.jpg", 0xff01)
+	if err := x.Remove("a.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := x.Nearest(0xff00, 2); !ok || e.Path != "b.jpg" {
+		t.Fatalf("expected b.jpg as nearest, found %+v", e)
+	}
+	x, err = OpenIndex(DHash, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := x.Entries(); len(e) != 1 || e["b.jpg"].Hash != 0xff01 {
+		t.Fatalf("expected only b.jpg in index file, found %+v", e)
+	}
+}
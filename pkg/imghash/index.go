@@ -0,0 +1,171 @@
+package imghash
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+type Entry struct {
+	Path string
+	Hash Hash
+}
+
+// Index keeps hashes of images in a store, entries are appended to a jsonl
+// file so the index survives runs. An index without file lives in memory.
+type Index struct {
+	l       sync.Mutex
+	algo    Algo
+	file    string
+	entries []Entry
+}
+
+// IndexFile is the index file of algo kept in dir of a store
+func IndexFile(dir string, algo Algo) string {
+	return filepath.Join(dir, fmt.Sprintf(".%s.jsonl", algo))
+}
+
+// OpenIndex loads index from file, file is created on first Add
+func OpenIndex(algo Algo, file string) (*Index, error) {
+	x := &Index{algo: algo, file: file}
+	if file == "" {
+		return x, nil
+	}
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return x, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e Entry
+		// a line cut by a crash is dropped, its image is hashed again
+		if json.Unmarshal(sc.Bytes(), &e) == nil {
+			x.entries = append(x.entries, e)
+		}
+	}
+	return x, sc.Err()
+}
+
+func (x *Index) Algo() Algo {
+	return x.algo
+}
+
+func (x *Index) Add(path string, h Hash) error {
+	defer x.l.Unlock()
+	x.l.Lock()
+	e := Entry{Path: path, Hash: h}
+	x.entries = append(x.entries, e)
+	if x.file == "" {
+		return nil
+	}
+	f, err := os.OpenFile(x.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, _ := json.Marshal(e)
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Remove drops entries of path, index file is rewritten without them
+func (x *Index) Remove(path string) error {
+	defer x.l.Unlock()
+	x.l.Lock()
+	x.entries = slices.DeleteFunc(x.entries, func(e Entry) bool {
+		return e.Path == path
+	})
+	if x.file == "" {
+		return nil
+	}
+	f, err := os.CreateTemp(filepath.Dir(x.file), filepath.Base(x.file)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	w := bufio.NewWriter(f)
+	for _, e := range x.entries {
+		data, _ := json.Marshal(e)
+		w.Write(append(data, '\n'))
+	}
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), x.file)
+}
+
+// Nearest returns entry closest to h if it is within maxDist
+func (x *Index) Nearest(h Hash, maxDist int) (Entry, bool) {
+	defer x.l.Unlock()
+	x.l.Lock()
+	best, found := Entry{}, false
+	bestDist := maxDist + 1
+	for _, e := range x.entries {
+		if d := Distance(e.Hash, h); d < bestDist {
+			best, bestDist, found = e, d, true
+		}
+	}
+	return best, found
+}
+
+// Entries returns the latest entry of every path
+func (x *Index) Entries() map[string]Entry {
+	defer x.l.Unlock()
+	x.l.Lock()
+	m := make(map[string]Entry, len(x.entries))
+	for _, e := range x.entries {
+		m[e.Path] = e
+	}
+	return m
+}
+
+// Clusters groups entries which are within maxDist of any other entry of the
+// group, only groups of 2 or more are returned
+func Clusters(entries []Entry, maxDist int) (clusters [][]Entry) {
+	parent := make([]int, len(entries))
+	for n := range parent {
+		parent[n] = n
+	}
+	var find func(int) int
+	find = func(n int) int {
+		if parent[n] != n {
+			parent[n] = find(parent[n])
+		}
+		return parent[n]
+	}
+	for a := range entries {
+		for b := a + 1; b < len(entries); b++ {
+			if Distance(entries[a].Hash, entries[b].Hash) <= maxDist {
+				parent[find(a)] = find(b)
+			}
+		}
+	}
+	groups := make(map[int][]Entry)
+	var roots []int
+	for n, e := range entries {
+		r := find(n)
+		if _, ok := groups[r]; !ok {
+			roots = append(roots, r)
+		}
+		groups[r] = append(groups[r], e)
+	}
+	for _, r := range roots {
+		if len(groups[r]) > 1 {
+			clusters = append(clusters, groups[r])
+		}
+	}
+	return clusters
+}
@@ -0,0 +1,104 @@
+package kv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/shivamhw/content-pirate/pkg/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltDb is a disk backed KV, every namespace is stored as a bucket
+type BoltDb struct {
+	db   *bolt.DB
+	path string
+}
+
+type BoltOpts struct {
+	Path     string
+	ReadOnly bool
+	Timeout  time.Duration
+}
+
+func GetBoltKv(opts BoltOpts) (*BoltDb, error) {
+	if opts.Path == "" {
+		return nil, fmt.Errorf("bolt kv path is empty")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if !opts.ReadOnly {
+		if err := os.MkdirAll(filepath.Dir(opts.Path), 0755); err != nil {
+			return nil, err
+		}
+	}
+	db, err := bolt.Open(opts.Path, 0600, &bolt.Options{
+		Timeout:  opts.Timeout,
+		ReadOnly: opts.ReadOnly,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("opening bolt kv %s failed %w", opts.Path, err)
+	}
+	log.Infof("using bolt kv", "path", opts.Path, "readOnly", opts.ReadOnly)
+	return &BoltDb{
+		db:   db,
+		path: opts.Path,
+	}, nil
+}
+
+func (b *BoltDb) Get(ns string, key string) (val []byte, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		bk := tx.Bucket([]byte(ns))
+		if bk == nil {
+			return fmt.Errorf("key not found, ns %s key %s", ns, key)
+		}
+		v := bk.Get([]byte(key))
+		if v == nil {
+			return fmt.Errorf("key not found, ns %s key %s", ns, key)
+		}
+		// value is only valid till tx is open
+		val = append([]byte{}, v...)
+		return nil
+	})
+	return val, err
+}
+
+func (b *BoltDb) Set(ns string, key string, val []byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bk, err := tx.CreateBucketIfNotExists([]byte(ns))
+		if err != nil {
+			return err
+		}
+		return bk.Put([]byte(key), val)
+	})
+}
+
+func (b *BoltDb) Del(ns string, key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bk := tx.Bucket([]byte(ns))
+		if bk == nil {
+			return fmt.Errorf("namespace not found %s", ns)
+		}
+		return bk.Delete([]byte(key))
+	})
+}
+
+func (b *BoltDb) Keys(ns string) (keys []string, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		bk := tx.Bucket([]byte(ns))
+		if bk == nil {
+			return nil
+		}
+		return bk.ForEach(func(k, _ []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	return keys, err
+}
+
+func (b *BoltDb) Close() error {
+	return b.db.Close()
+}
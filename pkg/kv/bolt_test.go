@@ -0,0 +1,52 @@
+package kv_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/shivamhw/content-pirate/pkg/kv"
+)
+
+func getBolt(t *testing.T, path string) *kv.BoltDb {
+	b, err := kv.GetBoltKv(kv.BoltOpts{Path: path})
+	if err != nil {
+		t.Fatalf("failed opening bolt %s", err)
+	}
+	return b
+}
+
+func TestBoltPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	b := getBolt(t, path)
+	if err := b.Set("task", "123", []byte("details")); err != nil {
+		t.Fatalf("failed in set %s", err)
+	}
+	b.Close()
+
+	b = getBolt(t, path)
+	defer b.Close()
+	val, err := b.Get("task", "123")
+	if err != nil {
+		t.Fatalf("failed in get after reopen %s", err)
+	}
+	if string(val) != "details" {
+		t.Fatalf("wrong value found %s", string(val))
+	}
+}
+
+func TestBoltDel(t *testing.T) {
+	b := getBolt(t, filepath.Join(t.TempDir(), "state.db"))
+	defer b.Close()
+	if _, err := b.Get("task", "123"); err == nil {
+		t.Fatal("found key in empty ns")
+	}
+	if err := b.Set("task", "123", []byte("details")); err != nil {
+		t.Fatalf("failed in set %s", err)
+	}
+	if err := b.Del("task", "123"); err != nil {
+		t.Fatalf("failed in del %s", err)
+	}
+	if val, err := b.Get("task", "123"); err == nil {
+		t.Fatalf("deleted value found %s", string(val))
+	}
+}
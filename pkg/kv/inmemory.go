@@ -61,3 +61,12 @@ func (i *InMemDb) Del(ns string, key string) (error) {
 	delete(b, key)
 	return nil
 }
+
+func (i *InMemDb) Keys(ns string) (keys []string, err error) {
+	defer i.l.Unlock()
+	i.l.Lock()
+	for k := range i.db[ns] {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
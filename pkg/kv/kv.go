@@ -4,4 +4,5 @@ type KV interface {
 	Get(ns string, key string)([]byte, error)
 	Set(ns string, key string, val []byte) error
 	Del(ns string, key string) error
+	Keys(ns string) ([]string, error)
 }
\ No newline at end of file
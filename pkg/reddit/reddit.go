@@ -2,6 +2,7 @@ package reddit
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"strings"
 	"time"
@@ -78,43 +79,39 @@ func NewRedditClient(ctx context.Context, opts RedditClientOpts) (*RedditClient,
 	return redditClient, nil
 }
 
-func (r *RedditClient) GetPosts(subreddit string, opts ListOptions) ([]*Post, error) {
+// sources of the authenticated account, other sources are u/<user> or a
+// subreddit with optional r/ prefix
+const (
+	SAVED_SOURCE   = "me/saved"
+	UPVOTED_SOURCE = "me/upvoted"
+)
+
+// listFunc fetches one page of a listing
+type listFunc func(opts reddit.ListOptions) ([]*reddit.Post, *reddit.Response, error)
+
+// GetPosts pages through posts of src, see SAVED_SOURCE for sources
+func (r *RedditClient) GetPosts(src string, opts ListOptions) ([]*Post, error) {
 	var final_posts []*Post
-	var posts []*reddit.Post
-	var resp *reddit.Response
-	var err error
 	opts.sanitize()
+	list, err := r.lister(src, opts)
+	if err != nil {
+		return nil, err
+	}
 	nextToken := opts.NextPage
-	log.Infof("scarpping reddit", "sub", subreddit, "filter", opts.Filter, "limit", opts.Limit)
+	log.Infof("scarpping reddit", "src", src, "filter", opts.Filter, "limit", opts.Limit)
 	for {
 		page := min(opts.Limit, 25)
 		opts.Limit -= page
 
-		switch opts.Filter {
-		case REDDIT_TOP:
-			posts, resp, err = r.Client.Subreddit.TopPosts(r.ctx, subreddit, &reddit.ListPostOptions{
-				ListOptions: reddit.ListOptions{
-					Limit: page,
-					After: nextToken,
-				},
-				Time: opts.Duration,
-			})
-		case REDDIT_HOT:
-			posts, resp, err = r.Client.Subreddit.HotPosts(r.ctx, subreddit, &reddit.ListOptions{
-				Limit: page,
-				After: nextToken,
-			})
-		case REDDIT_NEW:
-			posts, resp, err = r.Client.Subreddit.NewPosts(r.ctx, subreddit, &reddit.ListOptions{
-				Limit: page,
-				After: nextToken,
-			})
-		}
-
+		posts, resp, err := list(reddit.ListOptions{
+			Limit: page,
+			After: nextToken,
+		})
 		if err != nil {
 			if strings.Contains(err.Error(), "429") {
 				log.Warnf("HIT rate limit wait 2 sec")
 				time.Sleep(2 * time.Second)
+				opts.Limit += page
 				continue
 			} else {
 				return nil, err
@@ -132,6 +129,57 @@ func (r *RedditClient) GetPosts(subreddit string, opts ListOptions) ([]*Post, er
 	return final_posts, nil
 }
 
+func (r *RedditClient) lister(src string, opts ListOptions) (listFunc, error) {
+	switch {
+	case src == SAVED_SOURCE || src == UPVOTED_SOURCE:
+		if r.aCfg.Username == "" {
+			return nil, fmt.Errorf("%s needs username and password in reddit config", src)
+		}
+		if src == SAVED_SOURCE {
+			return func(l reddit.ListOptions) ([]*reddit.Post, *reddit.Response, error) {
+				// saved comments are skipped
+				posts, _, resp, err := r.Client.User.Saved(r.ctx, &reddit.ListUserOverviewOptions{ListOptions: l})
+				return posts, resp, err
+			}, nil
+		}
+		return func(l reddit.ListOptions) ([]*reddit.Post, *reddit.Response, error) {
+			return r.Client.User.Upvoted(r.ctx, &reddit.ListUserOverviewOptions{ListOptions: l})
+		}, nil
+	case strings.HasPrefix(src, "u/"):
+		user := strings.TrimPrefix(src, "u/")
+		if user == "" {
+			return nil, fmt.Errorf("user name missing in %s", src)
+		}
+		sort := strings.ToLower(strings.TrimPrefix(string(opts.Filter), "REDDIT_"))
+		return func(l reddit.ListOptions) ([]*reddit.Post, *reddit.Response, error) {
+			return r.Client.User.PostsOf(r.ctx, user, &reddit.ListUserOverviewOptions{
+				ListOptions: l,
+				Sort:        sort,
+				Time:        opts.Duration,
+			})
+		}, nil
+	}
+	subreddit := strings.TrimPrefix(src, "r/")
+	switch opts.Filter {
+	case REDDIT_TOP:
+		return func(l reddit.ListOptions) ([]*reddit.Post, *reddit.Response, error) {
+			return r.Client.Subreddit.TopPosts(r.ctx, subreddit, &reddit.ListPostOptions{
+				ListOptions: l,
+				Time:        opts.Duration,
+			})
+		}, nil
+	case REDDIT_HOT:
+		return func(l reddit.ListOptions) ([]*reddit.Post, *reddit.Response, error) {
+			return r.Client.Subreddit.HotPosts(r.ctx, subreddit, &l)
+		}, nil
+	case REDDIT_NEW:
+		return func(l reddit.ListOptions) ([]*reddit.Post, *reddit.Response, error) {
+			return r.Client.Subreddit.NewPosts(r.ctx, subreddit, &l)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown filter for reddit %s", opts.Filter)
+}
+
 func (r *RedditClient) GetSubscribedSubreddits(limit int) ([]*reddit.Subreddit, error) {
 	nextToken := ""
 	var err error
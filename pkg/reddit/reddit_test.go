@@ -0,0 +1,68 @@
+package reddit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vartanbeno/go-reddit/v2/reddit"
+)
+
+const listing = `{"kind":"Listing","data":{"after":%q,"children":[
+	{"kind":"t3","data":{"id":%q,"title":"post","url":"https://i.redd.it/a.jpg"}},
+	{"kind":"t1","data":{"id":"c1","body":"comment"}}
+]}}`
+
+func testClient(t *testing.T, username string) *RedditClient {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"access_token":"tok","token_type":"bearer","expires_in":3600}`)
+		case "/user/me/saved":
+			// two pages
+			if r.URL.Query().Get("after") == "" {
+				fmt.Fprintf(w, listing, "t3_s1", "s1")
+				return
+			}
+			fmt.Fprintf(w, listing, "", "s2")
+		case "/user/someone/submitted":
+			if q := r.URL.Query(); q.Get("sort") != "new" || q.Get("t") != "week" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintf(w, listing, "", "u1")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	c, err := reddit.NewClient(reddit.Credentials{ID: "id", Secret: "secret", Username: username, Password: "pw"},
+		reddit.WithBaseURL(srv.URL), reddit.WithTokenURL(srv.URL+"/token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &RedditClient{Client: c, aCfg: &authCfg{Username: username}, ctx: context.Background()}
+}
+
+func TestGetPostsOfUser(t *testing.T) {
+	r := testClient(t, "me")
+	posts, err := r.GetPosts(SAVED_SOURCE, ListOptions{Limit: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 2 || posts[0].ID != "s1" || posts[1].ID != "s2" {
+		t.Fatalf("expected saved posts of both pages without comments, found %d", len(posts))
+	}
+	posts, err = r.GetPosts("u/someone", ListOptions{Filter: REDDIT_NEW, Duration: "week"})
+	if err != nil || len(posts) != 1 || posts[0].ID != "u1" {
+		t.Fatalf("expected submission of user, found %v %v", posts, err)
+	}
+
+	r = testClient(t, "")
+	if _, err := r.GetPosts(UPVOTED_SOURCE, ListOptions{}); err == nil {
+		t.Fatalf("expected error for upvoted posts without account")
+	}
+}
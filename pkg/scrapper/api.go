@@ -1,14 +1,13 @@
 package scrapper
 
 import (
-	"encoding/json"
-	"sync/atomic"
+	"context"
+	"fmt"
 	"time"
 
 	log "log/slog"
 
 	"github.com/shivamhw/content-pirate/commons"
-	"github.com/shivamhw/content-pirate/sources"
 	"github.com/shivamhw/content-pirate/store"
 
 	"github.com/google/uuid"
@@ -21,20 +20,22 @@ type DownloadItemJob struct {
 }
 
 func (s *ScrapperV1) SubmitJob(j Job) (id string, err error) {
-	var stores []store.Store
+	s.ql.RLock()
+	defer s.ql.RUnlock()
+	if s.stopped {
+		return "", ScrapperStopped
+	}
 	id = uuid.NewString()
+	if j.SourceType == "" {
+		j.SourceType = s.sCfg.SourceType
+	}
+	if _, err = s.getSource(j.SourceType); err != nil {
+		return "", err
+	}
 	//create task from job
-	for _, dst := range j.Dst {
-		st, err := store.GetStore(dst)
-		if err != nil {
-			return "", err
-		}
-		//TODO fix this one on priority
-		if s.sCfg.SourceType == sources.SOURCE_TYPE_TELEGRAM {
-			log.Warn("using override to add tele client in store")
-			st.(*store.TelegramStore).C = s.SourceStore.(*sources.TelegramSource).GetClient()
-		}
-		stores = append(stores, st)
+	stores, err := s.getStores(j)
+	if err != nil {
+		return "", err
 	}
 	t := Task{
 		Id: id,
@@ -48,126 +49,281 @@ func (s *ScrapperV1) SubmitJob(j Job) (id string, err error) {
 		S: stores,
 	}
 	//put task to queue
-	log.Info("submitting task ", "task", t)
-	data, _ := json.Marshal(t)
-	err = s.KV.Set("task", id, data)
-	if err != nil {
+	log.Info("submitting task", "task", t.Id, "src", j.SrcAc, "type", j.SourceType, "dst", j.dstNames())
+	s.addTask(t.Id, stores)
+	if err = s.putTask(t); err != nil {
 		return "", err
 	}
-	s.taskStoreIdx[t.Id] = stores
 	s.M.TaskQ <- &t
 	return id, nil
 }
 
+func (s *ScrapperV1) getStores(j Job) (stores []store.Store, err error) {
+	for _, dst := range j.Dst {
+		st, err := store.GetStore(dst)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, st)
+	}
+	return stores, nil
+}
+
 func (s *ScrapperV1) GetJob(id string) (Task, error) {
-	var t Task
-	data, err := s.KV.Get("task", id)
+	t, err := s.loadTask(id)
 	if err != nil {
 		return Task{}, err
 	}
-	err = json.Unmarshal(data, &t)
-	if err != nil {
-		log.Error(err.Error())
+	if t.I, err = s.loadItems(id); err != nil {
 		return Task{}, err
 	}
 	return t, nil
 }
 
+// ListJobs returns every task in kv without its items, use GetJob for items
+func (s *ScrapperV1) ListJobs() (tasks []Task, err error) {
+	ids, err := s.KV.Keys(taskNs)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		t, err := s.loadTask(id)
+		if err != nil {
+			log.Warn("skipping unreadable task", "task", id, "err", err)
+			continue
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, nil
+}
+
 func (s *ScrapperV1) CheckJob(id string) (TaskStatus, error) {
-	t, err := s.GetJob(id)
+	return s.loadStatus(id)
+}
+
+// GetFailedItems lists items of a task which failed even after retries
+func (s *ScrapperV1) GetFailedItems(taskId string) (items []commons.Item, err error) {
+	if _, err = s.loadStatus(taskId); err != nil {
+		return nil, err
+	}
+	all, err := s.loadItems(taskId)
 	if err != nil {
-		return TaskStatus{}, err
+		return nil, err
+	}
+	for _, i := range all {
+		if i.Status == commons.FAILED {
+			items = append(items, i)
+		}
 	}
-	return t.Status, nil
+	return items, nil
 }
 
+// CancelJob stops scraping of a task, its queued items are dropped by workers
+func (s *ScrapperV1) CancelJob(id string) error {
+	s.l.Lock()
+	cancel, ok := s.taskCancel[id]
+	s.l.Unlock()
+	if !ok {
+		return JobNotFound
+	}
+	cancel(JobCancelled)
+	t, err := s.UpdateTask(id, TaskUpdateOpts{
+		TaskStatus: &TaskStatus{Status: TaskCancelled},
+	})
+	if err != nil {
+		return err
+	}
+	s.l.Lock()
+	stores := s.taskStoreIdx[id]
+	s.l.Unlock()
+	discardStores(stores)
+	closeStores(stores)
+	log.Info("cancelled task", "task", id)
+	s.ev.publish(Event{Type: TaskFinished, TaskId: id, Status: t.Status})
+	return nil
+}
+
+// WaitOnId waits for task to finish for waitFor minutes
 func (s *ScrapperV1) WaitOnId(id string, waitFor int) bool {
-	//check if id is done
 	log.Info("waiting to complete", "id", id)
-	deadline := time.Now().Add(time.Duration(waitFor) * time.Minute) // time out after 5 mins
-	for {
-		now := time.Now()
-		if now.After(deadline) {
-			log.Error("deadline excedded for task", "task", id)
-			return false
-		}
-		s, err := s.CheckJob(id)
-		if err != nil {
-			return false
-		}
-		log.Info("status", "task", id, "Completed", s.ItemDone, "Total", s.TotalItem)
-		time.Sleep(5 * time.Second)
-		if s.ItemDone >= s.TotalItem && s.Status != TaskCreated {
-			break
-		}
+	ctx, cancel := context.WithTimeout(s.ctx, time.Duration(waitFor)*time.Minute)
+	defer cancel()
+	st, err := s.Wait(ctx, id)
+	if err != nil {
+		log.Error("waiting for task failed", "task", id, "err", err)
+		return false
 	}
+	log.Info("status", "task", id, "Completed", st.ItemDone, "Total", st.TotalItem, "Status", st.Status)
 	return true
 }
 
 func (s *ScrapperV1) UpdateTask(id string, opts TaskUpdateOpts) (Task, error) {
 	defer s.l.Unlock()
 	s.l.Lock()
-	var t Task
-	data, err := s.KV.Get("task", id)
+	t, err := s.loadTask(id)
 	if err != nil {
 		return Task{}, err
 	}
-	err = json.Unmarshal(data, &t)
-	if err != nil {
-		return Task{}, err
-	}
-	if opts.TaskStatus != nil {
-		t.Status.TotalItem = opts.TaskStatus.TotalItem
+	if opts.TaskStatus != nil && !t.Status.Status.Finished() {
+		if opts.TaskStatus.Status != TaskCancelled {
+			t.Status.TotalItem = opts.TaskStatus.TotalItem
+		}
 		t.Status.Status = opts.TaskStatus.Status
 	}
 	if opts.Items != nil {
-		t.I = append(t.I, opts.Items...)
+		keys, err := s.KV.Keys(itemNs(id))
+		if err != nil {
+			return Task{}, err
+		}
+		for n, i := range opts.Items {
+			if err := s.putItem(id, itemRecord{Seq: int64(len(keys) + n), Item: i}); err != nil {
+				return Task{}, err
+			}
+		}
 	}
-	// hack alert
-	v, _ := json.Marshal(t)
-	err = s.KV.Set("task", id, v)
-	if err != nil {
+	if err := s.putStatus(id, t.Status); err != nil {
 		return Task{}, err
 	}
 	return t, nil
 }
 
-func (s *ScrapperV1) UpdateItemDone(id string, opts TaskUpdateOpts) (Task, error) {
+func (s *ScrapperV1) UpdateItem(taskId string, itemId string, opts commons.ItemUpdateOpts) (commons.Item, error) {
+	l := s.itemLock(taskId, itemId)
+	defer l.Unlock()
+	l.Lock()
+	r, err := s.getItem(taskId, itemId)
+	if err != nil {
+		return commons.Item{}, fmt.Errorf("item %s not found in task %s: %w", itemId, taskId, err)
+	}
+	i := &r.Item
+	if opts.Status != "" {
+		i.Status = opts.Status
+	}
+	if opts.Dst != "" {
+		i.Dst = opts.Dst
+	}
+	if opts.FileName != "" {
+		i.FileName = opts.FileName
+	}
+	if opts.Attempts > 0 {
+		i.Attempts = opts.Attempts
+	}
+	if opts.Err != "" {
+		i.Err = opts.Err
+	}
+	if opts.Size > 0 {
+		i.Size = opts.Size
+	}
+	if opts.Hash != "" {
+		i.Hash = opts.Hash
+	}
+	if opts.ImgHash != "" {
+		i.ImgHash = opts.ImgHash
+	}
+	if opts.AliasOf != "" {
+		i.AliasOf = opts.AliasOf
+	}
+	if opts.Dupes > 0 {
+		i.Dupes = opts.Dupes
+	}
+	if err := s.putItem(taskId, r); err != nil {
+		return commons.Item{}, err
+	}
+	return *i, nil
+}
+
+// addItem adds a scraped item to the task and counts it in TotalItem, items
+// already in the task are not added again so a task can be scraped again
+// on resume
+func (s *ScrapperV1) addItem(id string, i commons.Item) (added bool, err error) {
 	defer s.l.Unlock()
 	s.l.Lock()
-	var t Task
-	data, err := s.KV.Get("task", id)
-	if err != nil {
-		return Task{}, err
+	if _, err := s.getItem(id, i.Id); err == nil {
+		return false, nil
 	}
-	err = json.Unmarshal(data, &t)
+	st, err := s.loadStatus(id)
 	if err != nil {
-		return Task{}, err
+		return false, err
 	}
-	t.Status.ItemDone = opts.ItemDone
-	// hack alert
-	v, _ := json.Marshal(t)
-	err = s.KV.Set("task", id, v)
-	if err != nil {
-		return Task{}, err
+	if err := s.putItem(id, itemRecord{Seq: st.TotalItem, Item: i}); err != nil {
+		return false, err
 	}
-	return t, nil
+	prev := st.Status
+	st.TotalItem++
+	if !st.Status.Finished() {
+		st.Status = TaskStarted
+	}
+	log.Debug("updating total item", "task", id, "items", st.TotalItem)
+	s.saveStatus(id, prev, &st)
+	return true, nil
 }
 
-func (s *ScrapperV1) increment(id string) {
-
-	log.Debug("incrementing item done", "taskId", id)
-	t, err := s.GetJob(id)
+// count marks an item of the task done and updates the counter for its result
+func (s *ScrapperV1) count(id string, i *commons.Item, res itemResult) {
+	defer s.l.Unlock()
+	s.l.Lock()
+	log.Debug("incrementing item done", "taskId", id, "result", res)
+	st, err := s.loadStatus(id)
 	if err != nil {
-		log.Error("error incrementing", "taskId", id)
+		log.Error("error incrementing", "taskId", id, "err", err)
 		return
 	}
-	atomic.AddInt64(&t.Status.ItemDone, 1)
-	_, err = s.UpdateItemDone(id, TaskUpdateOpts{
-		TaskStatus: &t.Status,
-	})
+	prev := st.Status
+	st.ItemDone++
+	st.Dupes += int64(i.Dupes)
+	st.DupeBytes += int64(i.Dupes) * i.Size
+	switch res {
+	case itemSucceeded:
+		st.Succeeded++
+		st.Bytes += i.Size
+		if st.Media == nil {
+			st.Media = make(map[commons.MediaType]int64)
+		}
+		st.Media[i.Type]++
+	case itemFailed:
+		st.Failed++
+	case itemSkipped:
+		st.Skipped++
+	case itemCancelled:
+		st.Cancelled++
+	}
+	s.saveStatus(id, prev, &st)
+}
+
+// scrapeDone marks that source of the task is drained, err if scrape failed
+func (s *ScrapperV1) scrapeDone(id string, scrapeErr error) {
+	defer s.l.Unlock()
+	s.l.Lock()
+	st, err := s.loadStatus(id)
 	if err != nil {
-		log.Error("error incrementing", "taskId", id)
+		log.Error("error marking task scraped", "taskId", id, "err", err)
 		return
 	}
+	prev := st.Status
+	st.Scraped = true
+	if scrapeErr != nil && !st.Status.Finished() {
+		st.Status = TaskFailed
+	}
+	s.saveStatus(id, prev, &st)
+}
+
+// saveStatus persists status of task and publishes it, task is marked done
+// once source is drained and every item is processed. TaskFinished is only
+// published when the task leaves prev for a finished status, items which
+// finish after a cancel are published as updates. s.l must be held.
+func (s *ScrapperV1) saveStatus(id string, prev TaskStatusEnum, st *TaskStatus) {
+	if !st.Status.Finished() && st.Scraped && st.ItemDone >= st.TotalItem {
+		st.Status = TaskDone
+		go closeStores(s.taskStoreIdx[id])
+	}
+	if err := s.putStatus(id, *st); err != nil {
+		log.Error("error saving task", "taskId", id, "err", err)
+		return
+	}
+	ev := Event{Type: TaskUpdated, TaskId: id, Status: *st}
+	if !prev.Finished() && st.Status.Finished() {
+		log.Info("task finished", "task", id, "status", st.Status, "items", st.TotalItem)
+		ev.Type = TaskFinished
+	}
+	s.ev.publish(ev)
 }
@@ -0,0 +1,231 @@
+package scrapper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sync"
+
+	"github.com/shivamhw/content-pirate/commons"
+	"github.com/shivamhw/content-pirate/pkg/imghash"
+	"github.com/shivamhw/content-pirate/pkg/log"
+	"github.com/shivamhw/content-pirate/store"
+)
+
+// DedupeAction is what is done with an item whose content is already in a store
+type DedupeAction string
+
+const (
+	DedupeOff      DedupeAction = "off"      // write duplicates again
+	DedupeSkip     DedupeAction = "skip"     // do not write the item
+	DedupeHardlink DedupeAction = "hardlink" // link item path to the existing file, skip if store can't link
+	DedupeAlias    DedupeAction = "alias"    // do not write, record existing path as AliasOf of the item
+)
+
+func (d DedupeAction) valid() bool {
+	switch d {
+	case DedupeOff, DedupeSkip, DedupeHardlink, DedupeAlias:
+		return true
+	}
+	return false
+}
+
+// hashItem sets sha256 of downloaded content of item
+func hashItem(i *commons.Item) error {
+	r, err := i.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, r); err != nil {
+		return err
+	}
+	i.Hash = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+func hashKey(st store.Store, hash string) string {
+	return fmt.Sprintf("%s_sha256_%s", st.ID(), hash)
+}
+
+// hashLocks serialize find, write and index of same content in a store, so
+// of duplicates saved at once only the first is written
+type hashLocks [64]sync.Mutex
+
+func (s *ScrapperV1) hashLock(st store.Store, hash string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(hashKey(st, hash)))
+	return &s.hashL[h.Sum32()%uint32(len(s.hashL))]
+}
+
+// findDupe returns path of content of item already written to st, content
+// which was deleted or moved since is dropped from the index
+func (s *ScrapperV1) findDupe(st store.Store, i *commons.Item) (string, bool) {
+	if s.sCfg.Dedupe == DedupeOff || i.Hash == "" {
+		return "", false
+	}
+	key := hashKey(st, i.Hash)
+	v, err := s.cache.Kvd.Get(s.ctx, key)
+	if err != nil {
+		return "", false
+	}
+	existing := string(v)
+	if c, ok := st.(store.PathChecker); ok && !c.PathExists(existing) {
+		log.Warnf("indexed content is gone, writing item", "item", i.FileName, "path", existing, "store", st.ID())
+		if err := s.cache.Kvd.Delete(s.ctx, key); err != nil {
+			log.Warnf("dropping item hash failed", "item", i.Id, "store", st.ID(), "err", err)
+		}
+		return "", false
+	}
+	return existing, true
+}
+
+// indexItem records content of item as written to path of st
+func (s *ScrapperV1) indexItem(st store.Store, i *commons.Item, path string) {
+	if s.sCfg.Dedupe == DedupeOff || i.Hash == "" {
+		return
+	}
+	if err := s.cache.Kvd.Set(s.ctx, hashKey(st, i.Hash), []byte(path)); err != nil {
+		log.Warnf("indexing item hash failed", "item", i.Id, "store", st.ID(), "err", err)
+	}
+}
+
+// dedupe applies the configured action to item which is a duplicate of
+// existing in st, linked is true if item now exists at its own path
+func (s *ScrapperV1) dedupe(st store.Store, i *commons.Item, existing string) (linked bool, err error) {
+	i.Dupes++
+	switch s.sCfg.Dedupe {
+	case DedupeHardlink:
+		l, ok := st.(store.Linker)
+		if !ok {
+			log.Debugf("store can't link, skipping duplicate", "store", st.ID())
+			break
+		}
+		dst, err := l.Link(i, existing)
+		if err != nil {
+			return false, err
+		}
+		i.Dst = dst
+		log.Infof("linked duplicate", "item", i.FileName, "to", existing)
+		return true, nil
+	case DedupeAlias:
+		i.AliasOf = existing
+	}
+	log.Infof("skipping duplicate", "item", i.FileName, "of", existing, "store", st.ID())
+	return false, nil
+}
+
+// NearDupeCfg enables perceptual hashing of images, images within Distance
+// bits of an image in the store are handled as duplicates
+type NearDupeCfg struct {
+	Algo     imghash.Algo
+	Distance int
+}
+
+func (c *NearDupeCfg) sanitize() error {
+	if c.Algo == "" {
+		return nil
+	}
+	if !c.Algo.Valid() {
+		return fmt.Errorf("unknown image hash %s", c.Algo)
+	}
+	if c.Distance <= 0 {
+		c.Distance = 5
+	}
+	return nil
+}
+
+// imgIndexes are perceptual hash indexes per store, loaded on first use
+type imgIndexes struct {
+	l sync.Mutex
+	m map[string]*imghash.Index
+}
+
+func (s *ScrapperV1) imgIndex(st store.Store) (*imghash.Index, error) {
+	defer s.imgIdx.l.Unlock()
+	s.imgIdx.l.Lock()
+	if x, ok := s.imgIdx.m[st.ID()]; ok {
+		return x, nil
+	}
+	file := ""
+	if l, ok := st.(store.Local); ok {
+		file = imghash.IndexFile(l.Root(), s.sCfg.NearDupe.Algo)
+	}
+	x, err := imghash.OpenIndex(s.sCfg.NearDupe.Algo, file)
+	if err != nil {
+		return nil, err
+	}
+	s.imgIdx.m[st.ID()] = x
+	return x, nil
+}
+
+// imgHashItem sets perceptual hash of image items, images which can't be
+// decoded are only deduped by content
+func (s *ScrapperV1) imgHashItem(i *commons.Item) {
+	if s.sCfg.NearDupe.Algo == "" || i.Type != commons.IMG_TYPE {
+		return
+	}
+	r, err := i.Open()
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	h, err := imghash.Compute(s.sCfg.NearDupe.Algo, r)
+	if err != nil {
+		log.Debugf("image not hashed", "item", i.FileName, "err", err)
+		return
+	}
+	i.ImgHash = h.String()
+}
+
+// findNearDupe returns path of an image in st which looks like item, images
+// which were deleted or moved since are dropped from the index
+func (s *ScrapperV1) findNearDupe(st store.Store, i *commons.Item) (string, bool) {
+	if i.ImgHash == "" {
+		return "", false
+	}
+	h, err := imghash.ParseHash(i.ImgHash)
+	if err != nil {
+		return "", false
+	}
+	x, err := s.imgIndex(st)
+	if err != nil {
+		log.Warnf("loading image index failed", "store", st.ID(), "err", err)
+		return "", false
+	}
+	for {
+		e, ok := x.Nearest(h, s.sCfg.NearDupe.Distance)
+		if !ok {
+			return "", false
+		}
+		if c, ok := st.(store.PathChecker); ok && !c.PathExists(e.Path) {
+			log.Warnf("indexed image is gone, dropping it from index", "item", i.FileName, "path", e.Path, "store", st.ID())
+			// entry is gone from memory even if rewriting index file failed
+			if err := x.Remove(e.Path); err != nil {
+				log.Warnf("dropping image hash failed", "path", e.Path, "store", st.ID(), "err", err)
+			}
+			continue
+		}
+		return e.Path, true
+	}
+}
+
+func (s *ScrapperV1) indexImg(st store.Store, i *commons.Item, path string) {
+	if i.ImgHash == "" {
+		return
+	}
+	h, err := imghash.ParseHash(i.ImgHash)
+	if err != nil {
+		return
+	}
+	x, err := s.imgIndex(st)
+	if err == nil {
+		err = x.Add(path, h)
+	}
+	if err != nil {
+		log.Warnf("indexing image hash failed", "item", i.Id, "store", st.ID(), "err", err)
+	}
+}
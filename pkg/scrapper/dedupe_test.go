@@ -0,0 +1,179 @@
+package scrapper
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/shivamhw/content-pirate/commons"
+	"github.com/shivamhw/content-pirate/pkg/imghash"
+	"github.com/shivamhw/content-pirate/sources"
+)
+
+func TestDedupe(t *testing.T) {
+	for _, action := range []DedupeAction{DedupeSkip, DedupeHardlink} {
+		t.Run(string(action), func(t *testing.T) {
+			setDataDir(t)
+			src := &fakeSource{posts: []string{"a", "b"}, content: map[string]string{"a": "same", "b": "same"}}
+			// one worker so the second item finds the first in the index
+			s := newTestScrapper(t, src, &ScrapeCfg{Dedupe: action, ImgWorkers: 1})
+			dir := t.TempDir()
+			id, err := s.SubmitJob(fileJob(dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			st := waitDone(t, s, id)
+			if st.Dupes != 1 || st.DupeBytes != int64(len("same")) {
+				t.Fatalf("expected one dupe, found %+v", st)
+			}
+			a, err := os.Stat(filepath.Join(dir, "pics", "a.jpg"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.Stat(filepath.Join(dir, "pics", "b.jpg"))
+			switch action {
+			case DedupeSkip:
+				if !os.IsNotExist(err) || st.Skipped != 1 {
+					t.Fatalf("expected b skipped, found %v %+v", err, st)
+				}
+			case DedupeHardlink:
+				if err != nil || !os.SameFile(a, b) || st.Succeeded != 2 {
+					t.Fatalf("expected b linked to a, found %v %+v", err, st)
+				}
+			}
+		})
+	}
+}
+
+func TestDedupeConcurrentWorkers(t *testing.T) {
+	setDataDir(t)
+	const workers = 4
+	posts := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	content := make(map[string]string)
+	for _, p := range posts {
+		content[p] = "same"
+	}
+	// first items are saved at once by every worker
+	inFlight := sync.WaitGroup{}
+	inFlight.Add(workers)
+	src := &fakeSource{posts: posts, content: content}
+	src.beforeDownload = func(_ context.Context, i *commons.Item) error {
+		if slices.Index(posts, i.Id) < workers {
+			inFlight.Done()
+			inFlight.Wait()
+		}
+		return nil
+	}
+	s := newTestScrapper(t, src, &ScrapeCfg{ImgWorkers: workers})
+	dir := t.TempDir()
+	id, err := s.SubmitJob(fileJob(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := waitDone(t, s, id)
+	files, err := os.ReadDir(filepath.Join(dir, "pics"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || st.Succeeded != 1 || st.Dupes != int64(len(posts)-1) {
+		t.Fatalf("expected one copy written, found %d files %+v", len(files), st)
+	}
+}
+
+func TestDedupeIndexedFileGone(t *testing.T) {
+	setDataDir(t)
+	sources.Register(otherSource, func(_ context.Context, cfg *fakeSource) (sources.Source, error) {
+		return cfg, nil
+	})
+	other := &fakeSource{posts: []string{"c", "d"}, content: map[string]string{"c": "same", "d": "same"}}
+	s := newTestScrapper(t, &fakeSource{posts: []string{"a"}, content: map[string]string{"a": "same"}}, &ScrapeCfg{
+		ImgWorkers: 1,
+		SourceCfgs: map[sources.SourceType]any{otherSource: other},
+	})
+	dir := t.TempDir()
+	id, err := s.SubmitJob(fileJob(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitDone(t, s, id)
+	if err := os.Remove(filepath.Join(dir, "pics", "a.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	// c is written again as a is gone, d is a dupe of c
+	j := fileJob(dir)
+	j.SourceType = otherSource
+	if id, err = s.SubmitJob(j); err != nil {
+		t.Fatal(err)
+	}
+	if st := waitDone(t, s, id); st.Succeeded != 1 || st.Skipped != 1 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "pics", "c.jpg")); string(data) != "same" {
+		t.Fatalf("expected c written, found %q %v", data, err)
+	}
+}
+
+// gradientPng is an image with enough structure to be perceptually hashed
+func gradientPng(t *testing.T) string {
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	for y := range 64 {
+		for x := range 64 {
+			img.SetGray(x, y, color.Gray{uint8((x/8)*30 + (y/16)*10)})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestNearDupeIndexedFileGone(t *testing.T) {
+	setDataDir(t)
+	sources.Register(otherSource, func(_ context.Context, cfg *fakeSource) (sources.Source, error) {
+		return cfg, nil
+	})
+	img := gradientPng(t)
+	other := &fakeSource{posts: []string{"c", "d"}, content: map[string]string{"c": img, "d": img}}
+	s := newTestScrapper(t, &fakeSource{posts: []string{"a"}, content: map[string]string{"a": img}}, &ScrapeCfg{
+		Dedupe:     DedupeOff,
+		NearDupe:   NearDupeCfg{Algo: imghash.DHash},
+		ImgWorkers: 1,
+		SourceCfgs: map[sources.SourceType]any{otherSource: other},
+	})
+	dir := t.TempDir()
+	id, err := s.SubmitJob(fileJob(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitDone(t, s, id)
+	if err := os.Remove(filepath.Join(dir, "pics", "a.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	// c is written again as a is gone, d looks like c
+	j := fileJob(dir)
+	j.SourceType = otherSource
+	if id, err = s.SubmitJob(j); err != nil {
+		t.Fatal(err)
+	}
+	if st := waitDone(t, s, id); st.Succeeded != 1 || st.Skipped != 1 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pics", "c.jpg")); err != nil {
+		t.Fatalf("expected c written, found %v", err)
+	}
+	x, err := imghash.OpenIndex(imghash.DHash, imghash.IndexFile(dir, imghash.DHash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := x.Entries()[filepath.Join(dir, "pics", "a.jpg")]; ok {
+		t.Fatalf("expected a dropped from image index")
+	}
+}
@@ -4,6 +4,8 @@ type ScrErr string
 
 const (
 	JobNotFound ScrErr = "JOB_NOT_FOUND"
+	JobCancelled ScrErr = "JOB_CANCELLED"
+	ScrapperStopped ScrErr = "SCRAPPER_STOPPED"
 )
 
 
@@ -0,0 +1,109 @@
+package scrapper
+
+import (
+	"context"
+	"sync"
+
+	"github.com/shivamhw/content-pirate/commons"
+)
+
+type EventType string
+
+const (
+	ItemUpdated  EventType = "ITEM_UPDATED"
+	TaskUpdated  EventType = "TASK_UPDATED"
+	TaskFinished EventType = "TASK_FINISHED"
+)
+
+type Event struct {
+	Type   EventType
+	TaskId string
+	Status TaskStatus
+	Item   *commons.Item `json:",omitempty"`
+}
+
+// events fans out task and item events to subscribers, a subscriber of a
+// task is closed once the task is finished
+type events struct {
+	l    sync.Mutex
+	subs map[string]map[chan Event]struct{}
+}
+
+func newEvents() *events {
+	return &events{
+		subs: make(map[string]map[chan Event]struct{}),
+	}
+}
+
+// subscribe to events of task id, all tasks if id is empty
+func (e *events) subscribe(id string) (chan Event, func()) {
+	defer e.l.Unlock()
+	e.l.Lock()
+	c := make(chan Event, 100)
+	if e.subs[id] == nil {
+		e.subs[id] = make(map[chan Event]struct{})
+	}
+	e.subs[id][c] = struct{}{}
+	return c, func() {
+		defer e.l.Unlock()
+		e.l.Lock()
+		if _, ok := e.subs[id][c]; ok {
+			delete(e.subs[id], c)
+			close(c)
+		}
+	}
+}
+
+// publish never blocks, a slow subscriber misses events but not the close
+func (e *events) publish(ev Event) {
+	defer e.l.Unlock()
+	e.l.Lock()
+	for _, id := range []string{ev.TaskId, ""} {
+		for c := range e.subs[id] {
+			select {
+			case c <- ev:
+			default:
+			}
+		}
+	}
+	if ev.Type != TaskFinished {
+		return
+	}
+	for c := range e.subs[ev.TaskId] {
+		close(c)
+	}
+	delete(e.subs, ev.TaskId)
+}
+
+// Subscribe returns events of a task, or every task if id is empty, and a
+// func to unsubscribe. Channel of a task is closed after TaskFinished.
+func (s *ScrapperV1) Subscribe(id string) (<-chan Event, func()) {
+	return s.ev.subscribe(id)
+}
+
+// Wait blocks till task is done, cancelled or failed
+func (s *ScrapperV1) Wait(ctx context.Context, id string) (TaskStatus, error) {
+	c, unsub := s.ev.subscribe(id)
+	defer unsub()
+	st, err := s.CheckJob(id)
+	if err != nil {
+		return st, err
+	}
+	if st.Status.Finished() {
+		return st, nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			st, _ = s.CheckJob(id)
+			return st, ctx.Err()
+		case ev, ok := <-c:
+			if !ok {
+				return s.CheckJob(id)
+			}
+			if ev.Type == TaskFinished {
+				return ev.Status, nil
+			}
+		}
+	}
+}
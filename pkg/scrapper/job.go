@@ -1,6 +1,9 @@
 package scrapper
 
 import (
+	"encoding/json"
+	"fmt"
+
 	"github.com/shivamhw/content-pirate/sources"
 	"github.com/shivamhw/content-pirate/store"
 )
@@ -9,8 +12,55 @@ import (
 type Job struct {
 	SrcAc       string
 	SrcId       string
+	SourceType  sources.SourceType
 	Dst         []store.DstPath	`json:"-"`
 	Opts        JobOpts
 }
 
 type JobOpts = sources.ScrapeOpts
+
+// dstNames are type and base path of dsts for logs, base paths of dsts
+// carry no credentials
+func (j Job) dstNames() []string {
+	names := make([]string, len(j.Dst))
+	for n, d := range j.Dst {
+		names[n] = fmt.Sprintf("%s:%s", d.Type(), d.GetBasePath())
+	}
+	return names
+}
+
+type jobAlias Job
+
+// jobJson keeps dst paths in the kv so a job can be rebuilt on resume
+type jobJson struct {
+	jobAlias
+	DstCfg []store.DstPathCfg
+}
+
+func (j Job) MarshalJSON() ([]byte, error) {
+	v := jobJson{jobAlias: jobAlias(j)}
+	for _, d := range j.Dst {
+		c, err := store.EncodeDstPath(d)
+		if err != nil {
+			return nil, err
+		}
+		v.DstCfg = append(v.DstCfg, c)
+	}
+	return json.Marshal(v)
+}
+
+func (j *Job) UnmarshalJSON(data []byte) error {
+	var v jobJson
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*j = Job(v.jobAlias)
+	for _, c := range v.DstCfg {
+		d, err := store.DecodeDstPath(c)
+		if err != nil {
+			return err
+		}
+		j.Dst = append(j.Dst, d)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package scrapper
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gotd/td/tgerr"
+	"github.com/shivamhw/content-pirate/sources"
+)
+
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration // wait before 2nd attempt, doubled after every attempt
+	MaxBackoff  time.Duration
+	// Retryable decides if an item error is worth another attempt, IsRetryable if nil
+	Retryable func(error) bool `json:"-"`
+}
+
+func (r *RetryPolicy) sanitize() {
+	if r.MaxAttempts <= 0 {
+		r.MaxAttempts = 3
+	}
+	if r.Backoff <= 0 {
+		r.Backoff = 2 * time.Second
+	}
+	if r.MaxBackoff <= 0 {
+		r.MaxBackoff = time.Minute
+	}
+	if r.Retryable == nil {
+		r.Retryable = IsRetryable
+	}
+}
+
+// delay returns wait before the next attempt, attempt starts from 1
+func (r *RetryPolicy) delay(attempt int, err error) time.Duration {
+	if d, ok := tgerr.AsFloodWait(err); ok {
+		return d + time.Second
+	}
+	d := r.Backoff
+	for range attempt - 1 {
+		d *= 2
+		if d >= r.MaxBackoff {
+			return r.MaxBackoff
+		}
+	}
+	return d
+}
+
+// IsRetryable is true for rate limits, server errors, telegram flood waits and timeouts
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if _, ok := tgerr.AsFloodWait(err); ok {
+		return true
+	}
+	var hErr *sources.HttpError
+	if errors.As(err, &hErr) {
+		return hErr.Code == http.StatusTooManyRequests || hErr.Code >= http.StatusInternalServerError
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var nErr net.Error
+	return errors.As(err, &nErr) && nErr.Timeout()
+}
+
+// wait sleeps for d or till ctx is done
+func wait(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,52 @@
+package scrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tgerr"
+	"github.com/shivamhw/content-pirate/sources"
+)
+
+func TestIsRetryable(t *testing.T) {
+	cases := map[error]bool{
+		&sources.HttpError{Code: 429}:                           true,
+		&sources.HttpError{Code: 502}:                           true,
+		&sources.HttpError{Code: 404}:                           false,
+		fmt.Errorf("wrapped %w", &sources.HttpError{Code: 500}): true,
+		tgerr.New(420, "FLOOD_WAIT_3"):                          true,
+		context.DeadlineExceeded:                                true,
+		&net.OpError{Op: "dial", Err: timeoutErr{}}:             true,
+		context.Canceled:                                        false,
+		errors.New("bad content"):                               false,
+	}
+	for err, want := range cases {
+		if got := IsRetryable(err); got != want {
+			t.Errorf("%v: expected retryable %v, found %v", err, want, got)
+		}
+	}
+}
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+func TestRetryDelay(t *testing.T) {
+	r := RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	r.sanitize()
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if d := r.delay(attempt+1, errors.New("err")); d != want {
+			t.Errorf("attempt %d: expected %s, found %s", attempt+1, want, d)
+		}
+	}
+	// flood waits are waited out whatever the attempt
+	if d := r.delay(1, tgerr.New(420, "FLOOD_WAIT_30")); d != 31*time.Second {
+		t.Errorf("expected flood wait of 31s, found %s", d)
+	}
+}
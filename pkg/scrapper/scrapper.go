@@ -1,6 +1,8 @@
 package scrapper
 
 import (
+	"context"
+
 	"github.com/shivamhw/content-pirate/commons"
 )
 
@@ -8,9 +10,15 @@ type Scrapper interface {
 	SubmitJob(Job) (string, error)
 	CheckJob(string) (TaskStatus, error)
 	GetJob(string) (Task, error)
-	AddItem(taskId string) (error)
-	UpdateItem(itemId string, opts commons.ItemUpdateOpts) (commons.Item, error)
+	ListJobs() ([]Task, error)
+	UpdateItem(taskId string, itemId string, opts commons.ItemUpdateOpts) (commons.Item, error)
 	UpdateTask(taskId string, opts TaskUpdateOpts) (Task, error)
-	Stop()
+	GetFailedItems(taskId string) ([]commons.Item, error)
+	CancelJob(string) error
+	Wait(ctx context.Context, id string) (TaskStatus, error)
+	Subscribe(id string) (<-chan Event, func())
+	Stop(context.Context) error
 	Start() 
-}
\ No newline at end of file
+}
+
+var _ Scrapper = (*ScrapperV1)(nil)
\ No newline at end of file
@@ -2,7 +2,10 @@ package scrapper
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -10,24 +13,38 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/shivamhw/content-pirate/commons"
+	"github.com/shivamhw/content-pirate/pkg/imghash"
 	"github.com/shivamhw/content-pirate/pkg/kv"
 	"github.com/shivamhw/content-pirate/pkg/log"
-	"github.com/shivamhw/content-pirate/pkg/reddit"
 	"github.com/shivamhw/content-pirate/pkg/telegram"
 	"github.com/shivamhw/content-pirate/sources"
 	"github.com/shivamhw/content-pirate/store"
 )
 
 type ScrapperV1 struct {
-	SourceStore  sources.Source
+	srcs         map[sources.SourceType]sources.Source
+	srcL         *sync.Mutex
 	sCfg         *ScrapeCfg
 	ctx          context.Context
+	jobCtx       context.Context
+	stopJobs     context.CancelFunc
 	M            *Mediums
 	swg          sync.WaitGroup
+	twg          sync.WaitGroup
 	KV           kv.KV
 	l            *sync.Mutex
+	ql           *sync.RWMutex
+	stopped      bool
+	started      atomic.Bool
+	done         chan struct{}
 	taskStoreIdx map[string][]store.Store
+	taskCancel   map[string]context.CancelCauseFunc
+	taskCtx      map[string]context.Context
 	cache        *telegram.Store
+	imgIdx       *imgIndexes
+	ev           *events
+	itemL        itemLocks
+	hashL        hashLocks
 	Id           string
 }
 
@@ -45,7 +62,15 @@ type ScrapeCfg struct {
 	VidWorkers   int
 	TopicWorkers int
 	TimeOut      int64 //in seconds
-	SourceType   sources.SourceType
+	SourceType   sources.SourceType // default source of jobs, others are created on first job
+	KvPath       string // bolt file for task state, in memory if empty
+	KV           kv.KV `json:"-"` // prebuilt kv for task state, KvPath is ignored if set
+	Source       sources.Source `json:"-"` // prebuilt source registered as SourceType
+	SourceCfgs   map[sources.SourceType]any `json:"-"` // config passed to sources.New per type
+	Retry        RetryPolicy
+	TmpDir       string // dir for downloads in flight, os temp dir if empty
+	Dedupe       DedupeAction // action for content already in a store, skip if empty
+	NearDupe     NearDupeCfg // perceptual hashing of images, off if Algo is empty
 }
 
 type Mediums struct {
@@ -56,12 +81,6 @@ type Mediums struct {
 	msgq  chan DownloadItemJob
 }
 
-var (
-	imgCounter    int64
-	vidCounter    int64
-	masterCounter int64
-)
-
 func NewScrapper(cfg *ScrapeCfg) (scr *ScrapperV1, err error) {
 	err = cfg.sanitize()
 	ctx := context.Background()
@@ -82,74 +101,297 @@ func NewScrapper(cfg *ScrapeCfg) (scr *ScrapperV1, err error) {
 		vidq:  make(chan DownloadItemJob, 10),
 		msgq:  make(chan DownloadItemJob, 10),
 	}
+	db, err := cfg.getKv()
+	if err != nil {
+		return nil, err
+	}
+	// sources and stores live on ctx, jobCtx is only for work which stop can abort
+	jobCtx, stopJobs := context.WithCancel(ctx)
 	scr = &ScrapperV1{
 		sCfg:         cfg,
 		ctx:          ctx,
+		jobCtx:       jobCtx,
+		stopJobs:     stopJobs,
 		M:            m,
-		KV:           kv.GetInMemoryKv(),
+		KV:           db,
 		l:            &sync.Mutex{},
+		ql:           &sync.RWMutex{},
+		done:         make(chan struct{}),
 		taskStoreIdx: make(map[string][]store.Store),
+		taskCancel:   make(map[string]context.CancelCauseFunc),
+		taskCtx:      make(map[string]context.Context),
 		cache:        cache,
+		imgIdx:       &imgIndexes{m: make(map[string]*imghash.Index)},
+		ev:           newEvents(),
+		srcs:         make(map[sources.SourceType]sources.Source),
+		srcL:         &sync.Mutex{},
 		Id:           strings.Split(uuid.New().String(), "-")[0],
 	}
-	switch cfg.SourceType {
-	case sources.SOURCE_TYPE_REDDIT:
-		scr.SourceStore, err = sources.NewRedditStore(scr.ctx, &sources.RedditStoreOpts{
-			RedditClientOpts: reddit.RedditClientOpts{
-				CfgPath: cfg.AuthCfg,
-			},
-		})
-	case sources.SOURCE_TYPE_TELEGRAM:
-		scr.SourceStore, err = sources.NewTelegramSource(scr.ctx, &sources.TelegramSourceOtps{
-			PhoneNumber: cfg.PhoneNumber,
-		})
-	default:
-		return nil, fmt.Errorf("unknown source store %s", cfg.SourceType)
+	if cfg.Source != nil {
+		scr.srcs[cfg.SourceType] = cfg.Source
 	}
-	if err != nil {
+	// default source is created upfront so bad auth fails early
+	if _, err = scr.getSource(cfg.SourceType); err != nil {
 		return nil, err
 	}
 	return scr, nil
 }
 
 func (s *ScrapperV1) process(i *DownloadItemJob) {
-	//download file
-	defer s.increment(i.T.Id)
-	err := s.SourceStore.DownloadItem(i.I.Ctx, i.I)
+	retry := s.sCfg.Retry
+	downloaded := false
+	written := 0
+	defer dropDownload(i.I)
+	for {
+		i.I.Attempts++
+		err := s.attempt(i, &downloaded, &written)
+		if err == nil {
+			s.setItemStatus(i, commons.SUCCESS)
+			if written == 0 {
+				s.count(i.T.Id, i.I, itemSkipped)
+			} else {
+				s.count(i.T.Id, i.I, itemSucceeded)
+			}
+			return
+		}
+		taskCtx := s.getTaskCtx(i.T.Id)
+		if taskCtx.Err() != nil {
+			if errors.Is(context.Cause(taskCtx), JobCancelled) {
+				log.Warnf("task cancelled, dropping item", "task", i.T.Id, "item", i.I.Id)
+				s.setItemStatus(i, commons.CANCELLED)
+				s.count(i.T.Id, i.I, itemCancelled)
+			}
+			// scrapper is stopping, item stays pending for resume
+			return
+		}
+		i.I.Err = err.Error()
+		if i.I.Attempts >= retry.MaxAttempts || !retry.Retryable(err) {
+			log.Errorf("item failed", "item", i.I.FileName, "attempts", i.I.Attempts, "err", err)
+			s.setItemStatus(i, commons.FAILED)
+			s.count(i.T.Id, i.I, itemFailed)
+			return
+		}
+		d := retry.delay(i.I.Attempts, err)
+		log.Warnf("retrying item", "item", i.I.FileName, "attempt", i.I.Attempts, "in", d, "err", err)
+		s.setItemStatus(i, commons.PENDING)
+		if wait(taskCtx, d) != nil {
+			// cancelled while waiting, next attempt reports it
+			continue
+		}
+	}
+}
+
+// attempt downloads the item once and saves it to its stores
+func (s *ScrapperV1) attempt(i *DownloadItemJob, downloaded *bool, written *int) error {
+	ctx, cancel := s.itemCtx(i.T.Id)
+	defer cancel()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	i.I.Ctx = ctx
+	s.setItemStatus(i, commons.STARTED)
+	if !*downloaded && needsContent(i.stores, i.I) {
+		src, err := s.getSource(i.T.J.SourceType)
+		if err != nil {
+			return err
+		}
+		if err := s.download(src, i.I); err != nil {
+			log.Warnf("failed while downloading", "name", i.I.FileName, "error", err)
+			return err
+		}
+		*downloaded = true
+	}
+	n, err := s.saveItem(i)
+	*written += n
+	if err != nil {
+		log.Errorf("error saving", "item", i.I.FileName, "err", err)
+		return err
+	}
+	return nil
+}
+
+// download streams item into a temp file, stores read it back with
+// Item.Open so content is never held in memory
+func (s *ScrapperV1) download(src sources.Source, i *commons.Item) (err error) {
+	var f *os.File
+	if i.Path == "" {
+		f, err = os.CreateTemp(s.sCfg.TmpDir, "item-*")
+		if err == nil {
+			i.Path = f.Name()
+		}
+	} else {
+		// partial content of a failed attempt is dropped
+		f, err = os.Create(i.Path)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = src.DownloadItem(i.Ctx, i, f); err != nil {
+		return err
+	}
+	info, err := f.Stat()
 	if err != nil {
-		log.Warnf("failed while downloading", "name", i.I.FileName, "error", err)
+		return err
+	}
+	i.Size = info.Size()
+	// content and perceptual hashes are turned off on their own
+	if s.sCfg.Dedupe != DedupeOff {
+		if err = hashItem(i); err != nil {
+			return err
+		}
+	}
+	s.imgHashItem(i)
+	return nil
+}
+
+// needsContent reports if a store of item writes its content, items which
+// every store forwards by link are not downloaded
+func needsContent(stores []store.Store, i *commons.Item) bool {
+	for _, st := range stores {
+		if f, ok := st.(store.Forwarder); !ok || !f.Forwards(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// dropDownload removes temp file of item once every store is written
+func dropDownload(i *commons.Item) {
+	if i.Path == "" {
 		return
 	}
+	if err := os.Remove(i.Path); err != nil {
+		log.Warnf("removing downloaded file failed", "path", i.Path, "err", err)
+	}
+	i.Path = ""
+}
 
-	if err := s.saveItem(i); err != nil {
-		log.Errorf("error saving", "item", i.I.FileName, "err", err)
+// discardStores drops items buffered by stores of a cancelled task, so
+// closing them does not write those
+func discardStores(stores []store.Store) {
+	for _, st := range stores {
+		if d, ok := st.(store.Discarder); ok {
+			d.Discard()
+		}
 	}
-	atomic.AddInt64(&imgCounter, 1)
 }
 
-func (s *ScrapperV1) saveItem(i *DownloadItemJob) (err error) {
+// closeStores closes stores which hold resources, like open archives
+func closeStores(stores []store.Store) {
+	for _, st := range stores {
+		c, ok := st.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := c.Close(); err != nil {
+			log.Errorf("closing store failed", "store", st.ID(), "err", err)
+		}
+	}
+}
+
+func (s *ScrapperV1) itemCtx(taskId string) (context.Context, context.CancelFunc) {
+	ctx := s.getTaskCtx(taskId)
+	if s.sCfg.TimeOut > 0 {
+		return context.WithTimeout(ctx, time.Duration(s.sCfg.TimeOut)*time.Second)
+	}
+	return context.WithCancel(ctx)
+}
+
+// addTask registers stores and a cancellable context for a task
+func (s *ScrapperV1) addTask(id string, stores []store.Store) {
+	defer s.l.Unlock()
+	s.l.Lock()
+	ctx, cancel := context.WithCancelCause(s.jobCtx)
+	s.taskStoreIdx[id] = stores
+	s.taskCtx[id] = ctx
+	s.taskCancel[id] = cancel
+}
+
+func (s *ScrapperV1) getTaskCtx(id string) context.Context {
+	defer s.l.Unlock()
+	s.l.Lock()
+	if ctx, ok := s.taskCtx[id]; ok {
+		return ctx
+	}
+	return s.jobCtx
+}
+
+func (s *ScrapperV1) setItemStatus(i *DownloadItemJob, status commons.ItemStatus) {
+	i.I.Status = status
+	_, err := s.UpdateItem(i.T.Id, i.I.Id, commons.ItemUpdateOpts{
+		Status:   status,
+		Dst:      i.I.Dst,
+		Attempts: i.I.Attempts,
+		Err:      i.I.Err,
+		Size:     i.I.Size,
+		Hash:     i.I.Hash,
+		ImgHash:  i.I.ImgHash,
+		AliasOf:  i.I.AliasOf,
+		Dupes:    i.I.Dupes,
+	})
+	if err != nil {
+		log.Errorf("updating item status failed", "task", i.T.Id, "item", i.I.Id, "err", err)
+		return
+	}
+	item := *i.I
+	item.Ctx = nil
+	s.ev.publish(Event{Type: ItemUpdated, TaskId: i.T.Id, Item: &item})
+}
 
+// saveItem writes item to its stores and returns how many stores were written
+func (s *ScrapperV1) saveItem(i *DownloadItemJob) (written int, err error) {
 	for _, st := range i.stores {
-		dst := st.GetItemDstPath(i.I)
-		//save to dir
-		log.Debugf("saving file to filesystem", "dst", dst)
-		i.I.Dst = dst
-		key := fmt.Sprintf("%s_%s", st.ID(), i.I.FileName)
-		if _, err := s.cache.Kvd.Get(s.ctx, key); err == nil {
-			log.Warnf("cache hit, file found in store", "file", i.I.FileName, "store", st.ID())
-			continue
+		ok, err := s.saveTo(st, i.I)
+		if ok {
+			written++
 		}
-		atomic.AddInt64(&masterCounter, 1)
-		if dst, err := st.Write(i.I); err != nil {
-			return err
-		} else {
-			i.I.Dst = dst
-			s.cache.Kvd.Set(s.ctx, key, []byte(i.I.Id))
+		if err != nil {
+			return written, err
 		}
 	}
 	return
 }
 
+// saveTo writes item to st, written is false if st already had the item or
+// its content
+func (s *ScrapperV1) saveTo(st store.Store, i *commons.Item) (written bool, err error) {
+	dst := st.GetItemDstPath(i)
+	//save to dir
+	log.Debugf("saving file to filesystem", "dst", dst)
+	i.Dst = dst
+	key := fmt.Sprintf("%s_%s", st.ID(), i.FileName)
+	if _, err := s.cache.Kvd.Get(s.ctx, key); err == nil {
+		log.Warnf("cache hit, file found in store", "file", i.FileName, "store", st.ID())
+		return false, nil
+	}
+	if s.sCfg.Dedupe != DedupeOff && i.Hash != "" {
+		l := s.hashLock(st, i.Hash)
+		l.Lock()
+		defer l.Unlock()
+	}
+	existing, ok := s.findDupe(st, i)
+	if !ok {
+		existing, ok = s.findNearDupe(st, i)
+	}
+	if ok {
+		linked, err := s.dedupe(st, i, existing)
+		if err != nil {
+			return false, err
+		}
+		s.cache.Kvd.Set(s.ctx, key, []byte(i.Id))
+		return linked, nil
+	}
+	if dst, err = st.Write(i); err != nil {
+		return false, err
+	}
+	i.Dst = dst
+	s.cache.Kvd.Set(s.ctx, key, []byte(i.Id))
+	s.indexItem(st, i, dst)
+	s.indexImg(st, i, dst)
+	return true, nil
+}
+
 func (s *ScrapperV1) subWorker() {
 	wg := sync.WaitGroup{}
 LOOP:
@@ -159,47 +401,73 @@ LOOP:
 			if !ok {
 				break LOOP
 			}
-			log.Debugf("Scrapping", "src", v)
-			p, err := s.SourceStore.ScrapePosts(s.ctx, v.J.SrcAc, sources.ScrapeOpts(v.J.Opts))
+			log.Debugf("Scrapping", "task", v.Id, "src", v.J.SrcAc)
+			ctx := s.getTaskCtx(v.Id)
+			src, err := s.getSource(v.J.SourceType)
+			if err != nil {
+				log.Errorf("no source for task", "task", v.Id, "type", v.J.SourceType, "err", err)
+				s.scrapeDone(v.Id, err)
+				continue
+			}
+			p, err := src.ScrapePosts(ctx, v.J.SrcAc, sources.ScrapeOpts(v.J.Opts))
 			if err != nil {
-				log.Errorf("Error while scraping", "source", v, "err", err.Error())
+				log.Errorf("Error while scraping", "task", v.Id, "src", v.J.SrcAc, "err", err.Error())
+				s.scrapeDone(v.Id, err)
 				continue
 			}
 			wg.Add(1)
 			go func(wg *sync.WaitGroup) {
 				defer wg.Done()
+				defer func() {
+					if ctx.Err() == nil {
+						s.scrapeDone(v.Id, nil)
+					}
+				}()
 				for post := range p {
-					ctx := s.ctx
-
-					if s.sCfg.TimeOut > 0 {
-						ctx, _ = context.WithTimeout(ctx, time.Duration(s.sCfg.TimeOut)*time.Second)
+					if errors.Is(context.Cause(ctx), JobCancelled) {
+						// drain so the source can close its channel
+						continue
 					}
 					item := commons.Item{
 						Id:       post.Id,
 						Src:      post.SrcLink,
 						Title:    post.Title,
+						Author:   post.Author,
+						Date:     post.Date,
+						Score:    post.Score,
+						Permalink: post.Permalink,
+						Meta:     post.Meta,
 						FileName: post.FileName,
 						Type:     post.MediaType,
 						Ext:      post.Ext,
 						SourceAc: post.SourceAc,
-						Ctx:      ctx,
+						Status:   commons.PENDING,
+						GroupId:   post.GroupId,
+						GroupSize: post.GroupSize,
+						GroupIdx:  post.GroupIdx,
+					}
+					if item.FileName == "" {
+						item.FileName = fmt.Sprintf("%s.%s", item.Id, item.Ext)
 					}
-					v.I = append(v.I, item)
-					v.Status.TotalItem = int64(len(v.I))
-					log.Debugf("updating total item", "task", v.Id, "items", v.Status.TotalItem)
-					v.Status.Status = TaskStarted
-					nTask, err := s.UpdateTask(v.Id, TaskUpdateOpts{
-						TaskStatus: &v.Status,
-						Items:      []commons.Item{item},
-					})
-					v.Status = nTask.Status
+					added, err := s.addItem(v.Id, item)
 					if err != nil {
-						log.Errorf("updating status of task failed", "id", v.Id)
+						log.Errorf("adding item to task failed", "task", v.Id, "item", item.Id, "err", err)
+						continue
+					}
+					if !added {
+						// found by a previous run, resume queued it if unfinished
+						log.Debugf("item already in task", "task", v.Id, "item", item.Id)
+						continue
+					}
+					if ctx.Err() != nil {
+						// stopping, keep item pending for resume
+						continue
 					}
 					stores := s.filterStores(v, &item)
 					if len(stores) <= 0 {
 						log.Warnf("file exists in all stores not adding it to queue", "file", item.Dst)
-						s.increment(v.Id)
+						s.UpdateItem(v.Id, item.Id, commons.ItemUpdateOpts{Status: commons.SUCCESS})
+						s.count(v.Id, &item, itemSkipped)
 						continue
 					}
 					s.M.ItemQ <- DownloadItemJob{
@@ -213,12 +481,14 @@ LOOP:
 	}
 	log.Warnf("topic closed, waiting for routines to feed posts")
 	wg.Wait()
-	s.M.closeAll()
 	log.Warnf("stopped recieving topics to scrape... exiting")
 }
 
 func (s *ScrapperV1) filterStores(t *Task, i *commons.Item) (fStores []store.Store) {
-	for _, st := range s.taskStoreIdx[t.Id] {
+	s.l.Lock()
+	stores := s.taskStoreIdx[t.Id]
+	s.l.Unlock()
+	for _, st := range stores {
 		if st.ItemExists(i) {
 			log.Warnf("file already exist", "file", i.FileName)
 			continue
@@ -240,8 +510,17 @@ func (s *ScrapperV1) queueWorker(id int, q chan DownloadItemJob) {
 
 func (s *ScrapperV1) startWorkers() {
 	for range s.sCfg.TopicWorkers {
-		go s.subWorker()
+		s.twg.Add(1)
+		go func() {
+			defer s.twg.Done()
+			s.subWorker()
+		}()
 	}
+	go func() {
+		// items are fed only by topic workers once resume is done
+		s.twg.Wait()
+		s.M.closeAll()
+	}()
 
 	for i := range s.sCfg.ImgWorkers {
 		s.swg.Add(1)
@@ -260,9 +539,18 @@ func (s *ScrapperV1) startWorkers() {
 }
 
 func (s *ScrapperV1) Start() {
-	//reset counters
-	imgCounter, vidCounter = 0, 0
-	go s.startWorkers()
+	s.started.Store(true)
+	defer close(s.done)
+	s.startWorkers()
+	s.twg.Add(1)
+	go func() {
+		defer s.twg.Done()
+		s.ql.RLock()
+		defer s.ql.RUnlock()
+		if !s.stopped {
+			s.resume()
+		}
+	}()
 	t := time.NewTicker(5 * time.Second)
 	start := time.Now()
 LOOP:
@@ -272,6 +560,7 @@ LOOP:
 			if !ok {
 				close(s.M.imgq)
 				close(s.M.vidq)
+				close(s.M.msgq)
 				break LOOP
 			}
 			switch v.I.Type {
@@ -284,12 +573,109 @@ LOOP:
 			}
 		case <-t.C:
 			log.Debugf("scrapper heartbeat......")
-			log.Infof("total saved items", "posts", masterCounter, "time", fmt.Sprintf("%.f",time.Since(start).Minutes()))
+			sum := s.summary()
+			log.Infof("total saved items", "posts", sum.Succeeded, "time", fmt.Sprintf("%.f",time.Since(start).Minutes()))
 		}
 	}
 	s.swg.Wait()
-	log.Infof("Summary", "Processed Imgs :", imgCounter)
-	log.Infof("Summary", "Processed vids :", vidCounter)
+	sum := s.summary()
+	log.Infof("Summary", "Succeeded", sum.Succeeded, "Failed", sum.Failed, "Skipped", sum.Skipped, "Cancelled", sum.Cancelled, "Bytes", sum.Bytes)
+	log.Infof("Summary", "Duplicates", sum.Dupes, "Saved bytes", sum.DupeBytes)
+	for t, n := range sum.Media {
+		log.Infof("Summary", "Processed "+t, n)
+	}
+}
+
+// resume re-enqueues items of tasks which were not finished by a previous run
+func (s *ScrapperV1) resume() {
+	ids, err := s.KV.Keys("task")
+	if err != nil {
+		log.Errorf("listing tasks to resume failed", "err", err)
+		return
+	}
+	for _, id := range ids {
+		t, err := s.GetJob(id)
+		if err != nil || t.Status.Status == TaskDone || t.Status.Status == TaskCancelled {
+			continue
+		}
+		s.l.Lock()
+		_, known := s.taskStoreIdx[t.Id]
+		s.l.Unlock()
+		if known {
+			// submitted by this run
+			continue
+		}
+		stores, err := s.getStores(t.J)
+		if err != nil {
+			log.Errorf("creating stores for resumed task failed", "task", t.Id, "err", err)
+			continue
+		}
+		t.S = stores
+		s.addTask(t.Id, stores)
+		if t.Status.Status == TaskCreated {
+			log.Infof("resuming task from scrape", "task", t.Id, "src", t.J.SrcAc)
+			s.M.TaskQ <- &t
+			continue
+		}
+		cnt := 0
+		for n := range t.I {
+			item := t.I[n]
+			if item.Status != commons.PENDING && item.Status != commons.STARTED {
+				continue
+			}
+			s.M.ItemQ <- DownloadItemJob{
+				I:      &item,
+				T:      &t,
+				stores: stores,
+			}
+			cnt++
+		}
+		log.Infof("resumed task", "task", t.Id, "src", t.J.SrcAc, "items", cnt)
+		if !t.Status.Scraped {
+			// scrape again for items the previous run never reached, items
+			// already in the task are skipped
+			log.Infof("resuming task scrape", "task", t.Id, "src", t.J.SrcAc)
+			s.M.TaskQ <- &t
+		}
+	}
+}
+
+// summary adds up status of all tasks known to this run
+func (s *ScrapperV1) summary() (sum TaskStatus) {
+	s.l.Lock()
+	ids := make([]string, 0, len(s.taskStoreIdx))
+	for id := range s.taskStoreIdx {
+		ids = append(ids, id)
+	}
+	s.l.Unlock()
+	sum.Media = make(map[commons.MediaType]int64)
+	for _, id := range ids {
+		st, err := s.CheckJob(id)
+		if err != nil {
+			continue
+		}
+		sum.ItemDone += st.ItemDone
+		sum.TotalItem += st.TotalItem
+		sum.Succeeded += st.Succeeded
+		sum.Failed += st.Failed
+		sum.Skipped += st.Skipped
+		sum.Cancelled += st.Cancelled
+		sum.Bytes += st.Bytes
+		sum.Dupes += st.Dupes
+		sum.DupeBytes += st.DupeBytes
+		for t, n := range st.Media {
+			sum.Media[t] += n
+		}
+	}
+	return sum
+}
+
+func (s *ScrapperV1) notStarted() <-chan struct{} {
+	c := make(chan struct{})
+	if !s.started.Load() {
+		close(c)
+	}
+	return c
 }
 
 func (cfg *ScrapeCfg) sanitize() error {
@@ -303,13 +689,74 @@ func (cfg *ScrapeCfg) sanitize() error {
 	if cfg.VidWorkers <= 0 {
 		cfg.VidWorkers = 5
 	}
+	if cfg.Dedupe == "" {
+		cfg.Dedupe = DedupeSkip
+	}
+	if !cfg.Dedupe.valid() {
+		return fmt.Errorf("unknown dedupe action %s", cfg.Dedupe)
+	}
+	if err := cfg.NearDupe.sanitize(); err != nil {
+		return err
+	}
+	cfg.Retry.sanitize()
+	cfg.sourceCfgs()
 	return nil
 }
 
+func (cfg *ScrapeCfg) getKv() (kv.KV, error) {
+	if cfg.KV != nil {
+		return cfg.KV, nil
+	}
+	if cfg.KvPath == "" {
+		return kv.GetInMemoryKv(), nil
+	}
+	return kv.GetBoltKv(kv.BoltOpts{
+		Path: cfg.KvPath,
+	})
+}
+
 func (m *Mediums) closeAll() {
 	close(m.ItemQ)
 }
 
-func (s *ScrapperV1) Stop() {
+// Stop stops accepting jobs and waits for queued items to finish, once ctx
+// is done in flight downloads are aborted. Start returns before Stop does.
+func (s *ScrapperV1) Stop(ctx context.Context) (err error) {
 	log.Warnf("Stopping scrapper")
+	s.ql.Lock()
+	if s.stopped {
+		s.ql.Unlock()
+		return ScrapperStopped
+	}
+	s.stopped = true
+	close(s.M.TaskQ)
+	s.ql.Unlock()
+
+	select {
+	case <-s.done:
+	case <-s.notStarted():
+	case <-ctx.Done():
+		log.Warnf("stop timed out, aborting in flight items", "err", ctx.Err())
+		err = ctx.Err()
+		s.stopJobs()
+		<-s.done
+	}
+	s.stopJobs()
+	s.l.Lock()
+	var stores []store.Store
+	for _, st := range s.taskStoreIdx {
+		stores = append(stores, st...)
+	}
+	s.l.Unlock()
+	closeStores(stores)
+	if c, ok := s.KV.(io.Closer); ok {
+		if cErr := c.Close(); cErr != nil {
+			log.Errorf("closing kv failed", "err", cErr)
+		}
+	}
+	if cErr := s.cache.Close(); cErr != nil {
+		log.Errorf("closing cache failed", "err", cErr)
+	}
+	log.Warnf("scrapper stopped")
+	return err
 }
@@ -0,0 +1,516 @@
+package scrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shivamhw/content-pirate/commons"
+	"github.com/shivamhw/content-pirate/pkg/kv"
+	"github.com/shivamhw/content-pirate/pkg/telegram"
+	"github.com/shivamhw/content-pirate/sources"
+	"github.com/shivamhw/content-pirate/store"
+)
+
+// fakeSource scrapes posts with given ids, content of an item is its id
+// unless set in content
+type fakeSource struct {
+	posts   []string
+	content map[string]string
+	// scrapeErr is returned by ScrapePosts instead of posts
+	scrapeErr error
+	// errs are returned by successive downloads of an item
+	errs map[string][]error
+	// beforePost runs before post n is sent, an error ends the scrape
+	beforePost func(ctx context.Context, n int) error
+	// beforeDownload runs before content is written, an error fails the attempt
+	beforeDownload func(ctx context.Context, i *commons.Item) error
+
+	l         sync.Mutex
+	downloads map[string]int
+}
+
+func (f *fakeSource) ScrapePosts(ctx context.Context, src string, _ sources.ScrapeOpts) (chan sources.Post, error) {
+	if f.scrapeErr != nil {
+		return nil, f.scrapeErr
+	}
+	p := make(chan sources.Post)
+	go func() {
+		defer close(p)
+		for n, id := range f.posts {
+			if f.beforePost != nil && f.beforePost(ctx, n) != nil {
+				return
+			}
+			p <- sources.Post{
+				Id:        id,
+				MediaType: commons.IMG_TYPE,
+				SourceAc:  src,
+				Ext:       "jpg",
+				FileName:  id + ".jpg",
+			}
+		}
+	}()
+	return p, nil
+}
+
+func (f *fakeSource) DownloadItem(ctx context.Context, i *commons.Item, w io.Writer) error {
+	f.l.Lock()
+	if f.downloads == nil {
+		f.downloads = make(map[string]int)
+	}
+	attempt := f.downloads[i.Id]
+	f.downloads[i.Id]++
+	f.l.Unlock()
+	if attempt < len(f.errs[i.Id]) {
+		return f.errs[i.Id][attempt]
+	}
+	if f.beforeDownload != nil {
+		if err := f.beforeDownload(ctx, i); err != nil {
+			return err
+		}
+	}
+	content, ok := f.content[i.Id]
+	if !ok {
+		content = i.Id
+	}
+	_, err := io.WriteString(w, content)
+	return err
+}
+
+func (f *fakeSource) downloaded(id string) int {
+	defer f.l.Unlock()
+	f.l.Lock()
+	return f.downloads[id]
+}
+
+// newTestScrapper starts a scrapper over src, cfg may be nil
+func newTestScrapper(t *testing.T, src sources.Source, cfg *ScrapeCfg) *ScrapperV1 {
+	if cfg == nil {
+		cfg = &ScrapeCfg{}
+	}
+	if cfg.KV == nil {
+		cfg.KV = kv.GetInMemoryKv()
+	}
+	cfg.Source = src
+	cfg.Retry.Backoff = time.Millisecond
+	cfg.TmpDir = t.TempDir()
+	s, err := NewScrapper(cfg)
+	if err != nil {
+		t.Fatalf("creating scrapper failed %s", err)
+	}
+	go s.Start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.Stop(ctx)
+	})
+	return s
+}
+
+// setDataDir keeps the cache of scrappers of a test in its own dir
+func setDataDir(t *testing.T) {
+	dir := telegram.DataDir
+	telegram.DataDir = filepath.Join(t.TempDir(), "teleData")
+	t.Cleanup(func() {
+		telegram.DataDir = dir
+	})
+}
+
+func fileJob(dir string) Job {
+	return Job{SrcAc: "pics", Dst: []store.DstPath{store.FileDstPath{BasePath: dir}}}
+}
+
+func waitDone(t *testing.T, s *ScrapperV1, id string) TaskStatus {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	st, err := s.Wait(ctx, id)
+	if err != nil {
+		t.Fatalf("waiting for task failed %s, status %+v", err, st)
+	}
+	return st
+}
+
+func TestProgressAndRetry(t *testing.T) {
+	setDataDir(t)
+	src := &fakeSource{
+		posts: []string{"ok", "flaky", "gone"},
+		errs: map[string][]error{
+			"flaky": {&sources.HttpError{Code: 503}, &sources.HttpError{Code: 429}},
+			"gone":  {&sources.HttpError{Code: 404}},
+		},
+	}
+	s := newTestScrapper(t, src, nil)
+	dir := t.TempDir()
+	id, err := s.SubmitJob(fileJob(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := waitDone(t, s, id)
+	if st.Status != TaskDone || st.TotalItem != 3 || st.ItemDone != 3 || st.Succeeded != 2 || st.Failed != 1 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+	if st.Bytes != int64(len("ok")+len("flaky")) || st.Media[commons.IMG_TYPE] != 2 {
+		t.Fatalf("unexpected byte and media counters %+v", st)
+	}
+	if n := src.downloaded("flaky"); n != 3 {
+		t.Fatalf("expected flaky item downloaded 3 times, found %d", n)
+	}
+	failed, err := s.GetFailedItems(id)
+	if err != nil || len(failed) != 1 || failed[0].Id != "gone" || failed[0].Attempts != 1 {
+		t.Fatalf("expected gone item failed after 1 attempt, found %+v %v", failed, err)
+	}
+	j, err := s.GetJob(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, want := range src.posts {
+		if j.I[n].Id != want {
+			t.Fatalf("expected items in scrape order, found %s at %d", j.I[n].Id, n)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "pics", "flaky.jpg")); string(data) != "flaky" {
+		t.Fatalf("unexpected content of flaky item %q", data)
+	}
+	if left, _ := os.ReadDir(s.sCfg.TmpDir); len(left) != 0 {
+		t.Fatalf("expected downloads removed from tmp dir, found %d files", len(left))
+	}
+	if _, err := s.CheckJob("unknown"); !errors.Is(err, JobNotFound) {
+		t.Fatalf("expected JobNotFound, found %v", err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	setDataDir(t)
+	s := newTestScrapper(t, &fakeSource{posts: []string{"a", "b"}}, nil)
+	all, unsub := s.Subscribe("")
+	defer unsub()
+	id, err := s.SubmitJob(fileJob(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, _ := s.Subscribe(id)
+	var events []Event
+	timeout := time.After(10 * time.Second)
+	for len(events) == 0 || events[len(events)-1].Type != TaskFinished {
+		select {
+		case ev := <-all:
+			events = append(events, ev)
+		case <-timeout:
+			t.Fatalf("task not finished, events %+v", events)
+		}
+	}
+	// items go from started to success, task is finished last
+	seen := make(map[string]commons.ItemStatus)
+	for _, ev := range events[:len(events)-1] {
+		if ev.TaskId != id || ev.Type == TaskFinished {
+			t.Fatalf("unexpected event %+v", ev)
+		}
+		if ev.Type != ItemUpdated {
+			continue
+		}
+		if ev.Item.Status == commons.SUCCESS && seen[ev.Item.Id] != commons.STARTED {
+			t.Fatalf("item %s succeeded before it started", ev.Item.Id)
+		}
+		seen[ev.Item.Id] = ev.Item.Status
+	}
+	if len(seen) != 2 || seen["a"] != commons.SUCCESS || seen["b"] != commons.SUCCESS {
+		t.Fatalf("expected both items to succeed, found %v", seen)
+	}
+	if last := events[len(events)-1]; last.Status.Status != TaskDone || last.Status.Succeeded != 2 {
+		t.Fatalf("unexpected last event %+v", last)
+	}
+	// subscription of the task is closed once it is finished
+	for range task {
+	}
+}
+
+func TestResume(t *testing.T) {
+	setDataDir(t)
+	db := kv.GetInMemoryKv()
+	dir := t.TempDir()
+	// first run sees two posts and is stopped with both downloads in flight
+	inFlight := make(chan struct{}, 2)
+	first := &fakeSource{
+		posts: []string{"a", "b", "c", "d"},
+		beforePost: func(ctx context.Context, n int) error {
+			if n < 2 {
+				return nil
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		beforeDownload: func(ctx context.Context, _ *commons.Item) error {
+			inFlight <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+	s := newTestScrapper(t, first, &ScrapeCfg{KV: db})
+	id, err := s.SubmitJob(fileJob(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-inFlight
+	<-inFlight
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected stop to time out, found %v", err)
+	}
+	st, _ := s.CheckJob(id)
+	if st.Status != TaskStarted || st.Scraped || st.TotalItem != 2 || st.ItemDone != 0 {
+		t.Fatalf("expected unfinished task, found %+v", st)
+	}
+
+	// second run finishes pending items and scrapes the rest
+	second := &fakeSource{posts: first.posts}
+	s = newTestScrapper(t, second, &ScrapeCfg{KV: db})
+	st = waitDone(t, s, id)
+	if st.Status != TaskDone || st.TotalItem != 4 || st.Succeeded != 4 {
+		t.Fatalf("expected every post done after resume, found %+v", st)
+	}
+	for _, p := range first.posts {
+		if n := second.downloaded(p); n != 1 {
+			t.Fatalf("expected %s downloaded once on resume, found %d", p, n)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "pics", p+".jpg")); err != nil {
+			t.Fatalf("item %s not written %s", p, err)
+		}
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	setDataDir(t)
+	started := make(chan struct{}, 3)
+	src := &fakeSource{
+		posts: []string{"a", "b", "c"},
+		beforeDownload: func(ctx context.Context, _ *commons.Item) error {
+			started <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+	s := newTestScrapper(t, src, nil)
+	all, unsub := s.Subscribe("")
+	defer unsub()
+	id, err := s.SubmitJob(fileJob(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := s.CancelJob(id); err != nil {
+		t.Fatal(err)
+	}
+	st, err := s.CheckJob(id)
+	if err != nil || st.Status != TaskCancelled {
+		t.Fatalf("expected task cancelled, found %+v %v", st, err)
+	}
+	if st = waitDone(t, s, id); st.Status != TaskCancelled {
+		t.Fatalf("expected wait to return cancelled task, found %+v", st)
+	}
+	// items dropped after the cancel are updates of a finished task
+	finished := 0
+	timeout := time.After(10 * time.Second)
+	for st.Cancelled == 0 || st.ItemDone < st.TotalItem {
+		select {
+		case ev := <-all:
+			if ev.Type == TaskFinished {
+				finished++
+			}
+			if ev.Type != ItemUpdated {
+				st = ev.Status
+			}
+		case <-timeout:
+			t.Fatalf("cancelled items not counted, found %+v", st)
+		}
+	}
+	if finished != 1 {
+		t.Fatalf("expected one finished event, found %d", finished)
+	}
+	if err := s.CancelJob("unknown"); !errors.Is(err, JobNotFound) {
+		t.Fatalf("expected JobNotFound, found %v", err)
+	}
+}
+
+func TestStopDrains(t *testing.T) {
+	setDataDir(t)
+	src := &fakeSource{
+		posts: []string{"a", "b", "c"},
+		beforeDownload: func(ctx context.Context, _ *commons.Item) error {
+			return wait(ctx, 20*time.Millisecond)
+		},
+	}
+	s := newTestScrapper(t, src, nil)
+	dir := t.TempDir()
+	id, err := s.SubmitJob(fileJob(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// scraped items are fed before stop closes the queue
+	for {
+		st, _ := s.CheckJob(id)
+		if st.Scraped {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	st, err := s.CheckJob(id)
+	if err != nil || st.Status != TaskDone || st.TotalItem != 3 || st.Succeeded != 3 {
+		t.Fatalf("expected queued items done before stop returns, found %+v %v", st, err)
+	}
+	for _, p := range src.posts {
+		if _, err := os.Stat(filepath.Join(dir, "pics", p+".jpg")); err != nil {
+			t.Fatalf("item %s not written %s", p, err)
+		}
+	}
+	if _, err := s.SubmitJob(fileJob(t.TempDir())); !errors.Is(err, ScrapperStopped) {
+		t.Fatalf("expected ScrapperStopped, found %v", err)
+	}
+}
+
+func TestItemsStreamWhileScraping(t *testing.T) {
+	setDataDir(t)
+	done := make(chan struct{})
+	src := &fakeSource{posts: []string{"a", "b"}}
+	src.beforePost = func(ctx context.Context, n int) error {
+		if n == 0 {
+			return nil
+		}
+		// next post is only scraped once the first is downloaded
+		select {
+		case <-done:
+			return nil
+		case <-time.After(5 * time.Second):
+			t.Errorf("first item was not downloaded while scraping")
+			return fmt.Errorf("timed out")
+		}
+	}
+	src.beforeDownload = func(_ context.Context, i *commons.Item) error {
+		if i.Id == "a" {
+			close(done)
+		}
+		return nil
+	}
+	s := newTestScrapper(t, src, nil)
+	id, err := s.SubmitJob(fileJob(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := waitDone(t, s, id); st.Status != TaskDone || st.Succeeded != 2 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+}
+
+func TestScrapeErrorFailsTask(t *testing.T) {
+	setDataDir(t)
+	s := newTestScrapper(t, &fakeSource{scrapeErr: fmt.Errorf("listing failed")}, nil)
+	id, err := s.SubmitJob(fileJob(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := waitDone(t, s, id); st.Status != TaskFailed || !st.Scraped {
+		t.Fatalf("expected failed task, found %+v", st)
+	}
+}
+
+const otherSource sources.SourceType = "SOURCE_TYPE_TEST_OTHER"
+
+func TestSourcesPerJob(t *testing.T) {
+	setDataDir(t)
+	sources.Register(otherSource, func(_ context.Context, cfg *fakeSource) (sources.Source, error) {
+		return cfg, nil
+	})
+	other := &fakeSource{posts: []string{"x"}, content: map[string]string{"x": "other"}}
+	s := newTestScrapper(t, &fakeSource{posts: []string{"x"}}, &ScrapeCfg{
+		SourceCfgs: map[sources.SourceType]any{otherSource: other},
+	})
+	dirs := []string{t.TempDir(), t.TempDir()}
+	j := fileJob(dirs[1])
+	j.SourceType = otherSource
+	for n, j := range []Job{fileJob(dirs[0]), j} {
+		id, err := s.SubmitJob(j)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st := waitDone(t, s, id); st.Succeeded != 1 {
+			t.Fatalf("job %d: unexpected status %+v", n, st)
+		}
+	}
+	for n, want := range []string{"x", "other"} {
+		if data, _ := os.ReadFile(filepath.Join(dirs[n], "pics", "x.jpg")); string(data) != want {
+			t.Fatalf("job %d: expected content %q, found %q", n, want, data)
+		}
+	}
+	j.SourceType = "SOURCE_TYPE_UNKNOWN"
+	if _, err := s.SubmitJob(j); err == nil {
+		t.Fatalf("expected error for unknown source")
+	}
+}
+
+const linkDstType store.DstPathType = "LINK_DST_PATH"
+
+// linkStore forwards every item by link like telegram stores do for msgs
+type linkStore struct {
+	l       sync.Mutex
+	written []string
+}
+
+func (l *linkStore) Write(i *commons.Item) (string, error) {
+	defer l.l.Unlock()
+	l.l.Lock()
+	l.written = append(l.written, i.Id)
+	return i.Src, nil
+}
+
+func (l *linkStore) Forwards(*commons.Item) bool           { return true }
+func (l *linkStore) ItemExists(*commons.Item) bool         { return false }
+func (l *linkStore) GetItemDstPath(i *commons.Item) string { return i.Src }
+func (l *linkStore) CreateDir(string) error                { return nil }
+func (l *linkStore) CleanAll(string) error                 { return nil }
+func (l *linkStore) ID() string                            { return "link" }
+
+type linkDst struct{ st *linkStore }
+
+func (linkDst) GetBasePath() string     { return "" }
+func (linkDst) CleanOnStart() bool      { return false }
+func (linkDst) Type() store.DstPathType { return linkDstType }
+
+func TestForwardSkipsDownload(t *testing.T) {
+	setDataDir(t)
+	store.Register(linkDstType, func(p *linkDst) (store.Store, error) {
+		return p.st, nil
+	})
+	src := &fakeSource{posts: []string{"a", "b"}}
+	s := newTestScrapper(t, src, nil)
+	link := &linkStore{}
+	id, err := s.SubmitJob(Job{SrcAc: "pics", Dst: []store.DstPath{linkDst{link}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := waitDone(t, s, id); st.Succeeded != 2 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+	if len(link.written) != 2 || src.downloaded("a") != 0 || src.downloaded("b") != 0 {
+		t.Fatalf("expected items forwarded without download, found %v", link.written)
+	}
+
+	// a store which needs content still gets it
+	j := fileJob(t.TempDir())
+	j.SrcAc = "other"
+	j.Dst = append(j.Dst, linkDst{link})
+	if id, err = s.SubmitJob(j); err != nil {
+		t.Fatal(err)
+	}
+	if st := waitDone(t, s, id); st.Succeeded != 2 || src.downloaded("a") != 1 {
+		t.Fatalf("expected items downloaded for file store, found %+v", st)
+	}
+}
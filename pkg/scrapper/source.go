@@ -0,0 +1,51 @@
+package scrapper
+
+import (
+	"github.com/shivamhw/content-pirate/pkg/log"
+	"github.com/shivamhw/content-pirate/pkg/reddit"
+	"github.com/shivamhw/content-pirate/sources"
+)
+
+// getSource returns source of typ, creating it on first use so one scrapper
+// can serve jobs of different sources
+func (s *ScrapperV1) getSource(typ sources.SourceType) (sources.Source, error) {
+	if typ == "" {
+		typ = s.sCfg.SourceType
+	}
+	defer s.srcL.Unlock()
+	s.srcL.Lock()
+	if src, ok := s.srcs[typ]; ok {
+		return src, nil
+	}
+	src, err := s.newSource(typ)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("created source", "type", typ)
+	s.srcs[typ] = src
+	return src, nil
+}
+
+func (s *ScrapperV1) newSource(typ sources.SourceType) (sources.Source, error) {
+	return sources.New(s.ctx, typ, s.sCfg.SourceCfgs[typ])
+}
+
+// sourceCfgs fills config of built in sources from AuthCfg and PhoneNumber
+func (cfg *ScrapeCfg) sourceCfgs() {
+	if cfg.SourceCfgs == nil {
+		cfg.SourceCfgs = make(map[sources.SourceType]any)
+	}
+	if _, ok := cfg.SourceCfgs[sources.SOURCE_TYPE_REDDIT]; !ok {
+		cfg.SourceCfgs[sources.SOURCE_TYPE_REDDIT] = &sources.RedditStoreOpts{
+			RedditClientOpts: reddit.RedditClientOpts{
+				CfgPath: cfg.AuthCfg,
+			},
+			TmpDir: cfg.TmpDir,
+		}
+	}
+	if _, ok := cfg.SourceCfgs[sources.SOURCE_TYPE_TELEGRAM]; !ok {
+		cfg.SourceCfgs[sources.SOURCE_TYPE_TELEGRAM] = &sources.TelegramSourceOtps{
+			PhoneNumber: cfg.PhoneNumber,
+		}
+	}
+}
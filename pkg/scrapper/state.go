@@ -0,0 +1,129 @@
+package scrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/shivamhw/content-pirate/commons"
+)
+
+// a task is kept as separate records so updating an item or a counter
+// doesn't rewrite the whole task: the job under task/<id>, counters under
+// status/<id> and every item under item/<taskId>/<itemId>
+const (
+	taskNs   = "task"
+	statusNs = "status"
+)
+
+func itemNs(taskId string) string {
+	return "item/" + taskId
+}
+
+type taskRecord struct {
+	Id string
+	J  Job
+}
+
+// itemRecord keeps scrape order of an item, keys of a namespace are unordered
+type itemRecord struct {
+	Seq int64
+	commons.Item
+}
+
+// itemLocks serialize updates of an item without blocking other items
+type itemLocks [64]sync.Mutex
+
+func (s *ScrapperV1) itemLock(taskId, itemId string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(taskId + "/" + itemId))
+	return &s.itemL[h.Sum32()%uint32(len(s.itemL))]
+}
+
+func (s *ScrapperV1) putTask(t Task) error {
+	data, err := json.Marshal(taskRecord{Id: t.Id, J: t.J})
+	if err != nil {
+		return err
+	}
+	if err := s.putStatus(t.Id, t.Status); err != nil {
+		return err
+	}
+	return s.KV.Set(taskNs, t.Id, data)
+}
+
+// loadTask returns task with its status but without items
+func (s *ScrapperV1) loadTask(id string) (Task, error) {
+	data, err := s.KV.Get(taskNs, id)
+	if err != nil {
+		return Task{}, fmt.Errorf("%w: %s", JobNotFound, err)
+	}
+	var r taskRecord
+	if err := json.Unmarshal(data, &r); err != nil {
+		return Task{}, err
+	}
+	st, err := s.loadStatus(id)
+	if err != nil {
+		return Task{}, err
+	}
+	return Task{Id: r.Id, J: r.J, Status: st}, nil
+}
+
+func (s *ScrapperV1) putStatus(id string, st TaskStatus) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return s.KV.Set(statusNs, id, data)
+}
+
+func (s *ScrapperV1) loadStatus(id string) (st TaskStatus, err error) {
+	data, err := s.KV.Get(statusNs, id)
+	if err != nil {
+		return st, fmt.Errorf("%w: %s", JobNotFound, err)
+	}
+	err = json.Unmarshal(data, &st)
+	return st, err
+}
+
+func (s *ScrapperV1) putItem(taskId string, r itemRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.KV.Set(itemNs(taskId), r.Id, data)
+}
+
+func (s *ScrapperV1) getItem(taskId, itemId string) (r itemRecord, err error) {
+	data, err := s.KV.Get(itemNs(taskId), itemId)
+	if err != nil {
+		return r, err
+	}
+	err = json.Unmarshal(data, &r)
+	return r, err
+}
+
+// loadItems returns items of a task in scrape order
+func (s *ScrapperV1) loadItems(taskId string) ([]commons.Item, error) {
+	keys, err := s.KV.Keys(itemNs(taskId))
+	if err != nil {
+		return nil, err
+	}
+	records := make([]itemRecord, 0, len(keys))
+	for _, k := range keys {
+		r, err := s.getItem(taskId, k)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	sort.Slice(records, func(a, b int) bool {
+		return records[a].Seq < records[b].Seq
+	})
+	items := make([]commons.Item, len(records))
+	for n, r := range records {
+		items[n] = r.Item
+	}
+	return items, nil
+}
@@ -11,14 +11,38 @@ const (
 	TaskCreated TaskStatusEnum = "TASK_CREATED"
 	TaskStarted TaskStatusEnum = "TASK_STARTED"
 	TaskDone    TaskStatusEnum = "TASK_DONE"
+	TaskCancelled TaskStatusEnum = "TASK_CANCELLED"
+	TaskFailed  TaskStatusEnum = "TASK_FAILED"
 )
 
 type TaskStatus struct {
 	ItemDone  int64
 	TotalItem int64
+	Succeeded int64
+	Failed    int64
+	Skipped   int64 // found in cache or already in every store
+	Cancelled int64
+	Bytes     int64
+	Dupes     int64 // writes avoided as content was already in the store
+	DupeBytes int64 // bytes not written for dupes
+	Media     map[commons.MediaType]int64 // succeeded items per media type
+	Scraped   bool // source is drained, no more items will be added
 	Status    TaskStatusEnum
 }
 
+func (t TaskStatusEnum) Finished() bool {
+	return t == TaskDone || t == TaskCancelled || t == TaskFailed
+}
+
+type itemResult int
+
+const (
+	itemSucceeded itemResult = iota
+	itemFailed
+	itemSkipped
+	itemCancelled
+)
+
 type Task struct {
 	Id     string
 	J      Job
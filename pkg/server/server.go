@@ -0,0 +1,276 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/shivamhw/content-pirate/commons"
+	"github.com/shivamhw/content-pirate/pkg/log"
+	"github.com/shivamhw/content-pirate/pkg/scrapper"
+	"github.com/shivamhw/content-pirate/store"
+)
+
+// Server exposes a long running scrapper over http
+type Server struct {
+	s    scrapper.Scrapper
+	opts ServerOpts
+	mux  *http.ServeMux
+}
+
+// ServerOpts guard the api, zero value lets every client write anywhere the
+// process can
+type ServerOpts struct {
+	Token string // bearer token every request must carry, if set
+	Root  string // local dsts of submitted jobs must be under Root, if set
+}
+
+type SubmitResp struct {
+	Id string `json:"id"`
+}
+
+type ErrResp struct {
+	Error string `json:"error"`
+}
+
+func NewServer(s scrapper.Scrapper, opts ServerOpts) (*Server, error) {
+	if opts.Root != "" {
+		root, err := filepath.Abs(opts.Root)
+		if err != nil {
+			return nil, err
+		}
+		opts.Root = root
+	}
+	srv := &Server{
+		s:    s,
+		opts: opts,
+		mux:  http.NewServeMux(),
+	}
+	srv.mux.HandleFunc("POST /jobs", srv.submitJob)
+	srv.mux.HandleFunc("GET /jobs", srv.listJobs)
+	srv.mux.HandleFunc("GET /jobs/{id}", srv.getJob)
+	srv.mux.HandleFunc("GET /jobs/{id}/status", srv.checkJob)
+	srv.mux.HandleFunc("GET /jobs/{id}/items", srv.listItems)
+	srv.mux.HandleFunc("POST /jobs/{id}/cancel", srv.cancelJob)
+	srv.mux.HandleFunc("GET /jobs/{id}/events", srv.jobEvents)
+	srv.mux.HandleFunc("GET /events", srv.jobEvents)
+	return srv, nil
+}
+
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Debugf("api request", "method", r.Method, "path", r.URL.Path)
+	if !srv.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeJson(w, http.StatusUnauthorized, ErrResp{Error: "unauthorized"})
+		return
+	}
+	srv.mux.ServeHTTP(w, r)
+}
+
+func (srv *Server) authorized(r *http.Request) bool {
+	if srv.opts.Token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(srv.opts.Token)) == 1
+}
+
+// confine resolves local dsts under Root, relative paths are taken from
+// Root and paths outside of it are rejected
+func (srv *Server) confine(d store.DstPath) (store.DstPath, error) {
+	if srv.opts.Root == "" {
+		return d, nil
+	}
+	var err error
+	switch p := d.(type) {
+	case store.FileDstPath:
+		p.BasePath, err = srv.underRoot(p.BasePath)
+		return p, err
+	case store.ArchiveDstPath:
+		p.BasePath, err = srv.underRoot(p.BasePath)
+		return p, err
+	}
+	return d, nil
+}
+
+func (srv *Server) underRoot(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(srv.opts.Root, path)
+	}
+	path = filepath.Clean(path)
+	rel, err := filepath.Rel(srv.opts.Root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("dst %s is outside of %s", path, srv.opts.Root)
+	}
+	return path, nil
+}
+
+// submitJob takes a scrapper.Job, dst paths are passed as DstCfg and local
+// ones must be under Root
+func (srv *Server) submitJob(w http.ResponseWriter, r *http.Request) {
+	var j scrapper.Job
+	if err := json.NewDecoder(r.Body).Decode(&j); err != nil {
+		writeJson(w, http.StatusBadRequest, ErrResp{Error: err.Error()})
+		return
+	}
+	if j.SrcAc == "" {
+		writeJson(w, http.StatusBadRequest, ErrResp{Error: "SrcAc is required"})
+		return
+	}
+	for n, d := range j.Dst {
+		d, err := srv.confine(d)
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, ErrResp{Error: err.Error()})
+			return
+		}
+		j.Dst[n] = d
+	}
+	id, err := srv.s.SubmitJob(j)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJson(w, http.StatusAccepted, SubmitResp{Id: id})
+}
+
+func (srv *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	tasks, err := srv.s.ListJobs()
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	if tasks == nil {
+		tasks = []scrapper.Task{}
+	}
+	writeJson(w, http.StatusOK, tasks)
+}
+
+func (srv *Server) getJob(w http.ResponseWriter, r *http.Request) {
+	t, err := srv.s.GetJob(r.PathValue("id"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, t)
+}
+
+func (srv *Server) checkJob(w http.ResponseWriter, r *http.Request) {
+	st, err := srv.s.CheckJob(r.PathValue("id"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, st)
+}
+
+// listItems returns items of a task, filtered by ?status= if passed
+func (srv *Server) listItems(w http.ResponseWriter, r *http.Request) {
+	t, err := srv.s.GetJob(r.PathValue("id"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	status := commons.ItemStatus(r.URL.Query().Get("status"))
+	items := []commons.Item{}
+	for _, i := range t.I {
+		if status == "" || i.Status == status {
+			items = append(items, i)
+		}
+	}
+	writeJson(w, http.StatusOK, items)
+}
+
+func (srv *Server) cancelJob(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := srv.s.CancelJob(id); err != nil {
+		writeErr(w, err)
+		return
+	}
+	st, err := srv.s.CheckJob(id)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, st)
+}
+
+// jobEvents streams scrapper events as server sent events, stream of a task
+// ends once the task is finished
+func (srv *Server) jobEvents(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJson(w, http.StatusInternalServerError, ErrResp{Error: "streaming not supported"})
+		return
+	}
+	c, unsub := srv.s.Subscribe(id)
+	defer unsub()
+	var current *scrapper.TaskStatus
+	if id != "" {
+		st, err := srv.s.CheckJob(id)
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+		current = &st
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if current != nil {
+		ev := scrapper.Event{Type: scrapper.TaskUpdated, TaskId: id, Status: *current}
+		if current.Status.Finished() {
+			ev.Type = scrapper.TaskFinished
+		}
+		writeEvent(w, ev)
+		flusher.Flush()
+		if current.Status.Finished() {
+			return
+		}
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-c:
+			if !ok {
+				return
+			}
+			writeEvent(w, ev)
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, ev scrapper.Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		log.Errorf("marshalling event failed", "err", err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+}
+
+func writeJson(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("writing response failed", "err", err)
+	}
+}
+
+func writeErr(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, scrapper.JobNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, scrapper.ScrapperStopped):
+		code = http.StatusServiceUnavailable
+	}
+	writeJson(w, code, ErrResp{Error: err.Error()})
+}
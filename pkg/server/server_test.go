@@ -0,0 +1,179 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shivamhw/content-pirate/commons"
+	"github.com/shivamhw/content-pirate/pkg/scrapper"
+	"github.com/shivamhw/content-pirate/pkg/server"
+	"github.com/shivamhw/content-pirate/pkg/telegram"
+	"github.com/shivamhw/content-pirate/sources"
+)
+
+type fakeSource struct {
+	posts int
+}
+
+func (f *fakeSource) ScrapePosts(_ context.Context, src string, _ sources.ScrapeOpts) (chan sources.Post, error) {
+	p := make(chan sources.Post)
+	go func() {
+		defer close(p)
+		for n := range f.posts {
+			p <- sources.Post{
+				Id:        fmt.Sprintf("%d", n),
+				MediaType: commons.IMG_TYPE,
+				SourceAc:  src,
+				Ext:       "jpg",
+				FileName:  fmt.Sprintf("%d.jpg", n),
+			}
+		}
+	}()
+	return p, nil
+}
+
+func (f *fakeSource) DownloadItem(_ context.Context, i *commons.Item, w io.Writer) error {
+	_, err := io.WriteString(w, i.Id)
+	return err
+}
+
+func setup(t *testing.T) (*httptest.Server, string) {
+	dir := t.TempDir()
+	telegram.DataDir = filepath.Join(dir, "teleData")
+	s, err := scrapper.NewScrapper(&scrapper.ScrapeCfg{
+		Source: &fakeSource{posts: 3},
+	})
+	if err != nil {
+		t.Fatalf("creating scrapper failed %s", err)
+	}
+	go s.Start()
+	srv, err := server.NewServer(s, server.ServerOpts{Root: dir, Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(func() {
+		ts.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.Stop(ctx)
+	})
+	return ts, filepath.Join(dir, "download")
+}
+
+func call(t *testing.T, method, url, body, token string) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed %s", method, url, err)
+	}
+	return resp
+}
+
+func submit(t *testing.T, ts *httptest.Server, dir string) string {
+	body := fmt.Sprintf(`{"SrcAc":"pics","DstCfg":[{"Type":"FILE_DST_PATH","Cfg":{"BasePath":%q}}]}`, dir)
+	resp := call(t, http.MethodPost, ts.URL+"/jobs", body, "secret")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("submit returned %d", resp.StatusCode)
+	}
+	var r server.SubmitResp
+	json.NewDecoder(resp.Body).Decode(&r)
+	return r.Id
+}
+
+func TestSubmitAndStream(t *testing.T) {
+	ts, dir := setup(t)
+	id := submit(t, ts, dir)
+
+	resp := call(t, http.MethodGet, ts.URL+"/jobs/"+id+"/events", "", "secret")
+	defer resp.Body.Close()
+	var last scrapper.Event
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		if data, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+			json.Unmarshal([]byte(data), &last)
+		}
+	}
+	if last.Type != scrapper.TaskFinished || last.Status.Status != scrapper.TaskDone {
+		t.Fatalf("stream did not end with task done, last %+v", last)
+	}
+	if last.Status.Succeeded != 3 {
+		t.Fatalf("expected 3 succeeded items, found %d", last.Status.Succeeded)
+	}
+
+	resp = call(t, http.MethodGet, ts.URL+"/jobs/"+id+"/items?status=SUCCESS", "", "secret")
+	defer resp.Body.Close()
+	var items []commons.Item
+	json.NewDecoder(resp.Body).Decode(&items)
+	if len(items) != 3 {
+		t.Fatalf("expected 3 items, found %d", len(items))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pics", "0.jpg")); err != nil {
+		t.Fatalf("item not written %s", err)
+	}
+}
+
+func TestListAndNotFound(t *testing.T) {
+	ts, dir := setup(t)
+	id := submit(t, ts, dir)
+
+	resp := call(t, http.MethodGet, ts.URL+"/jobs", "", "secret")
+	defer resp.Body.Close()
+	var tasks []scrapper.Task
+	json.NewDecoder(resp.Body).Decode(&tasks)
+	if len(tasks) != 1 || tasks[0].Id != id {
+		t.Fatalf("expected submitted task in list, found %+v", tasks)
+	}
+
+	resp = call(t, http.MethodPost, ts.URL+"/jobs/unknown/cancel", "", "secret")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown job, found %d", resp.StatusCode)
+	}
+}
+
+func TestAuthAndRoot(t *testing.T) {
+	ts, dir := setup(t)
+	resp := call(t, http.MethodGet, ts.URL+"/jobs", "", "wrong")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for bad token, found %d", resp.StatusCode)
+	}
+
+	for _, dst := range []string{"/etc", filepath.Join(dir, "..", ".."), "../outside"} {
+		body := fmt.Sprintf(`{"SrcAc":"pics","DstCfg":[{"Type":"FILE_DST_PATH","Cfg":{"BasePath":%q}}]}`, dst)
+		resp = call(t, http.MethodPost, ts.URL+"/jobs", body, "secret")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected 400 for dst %s, found %d", dst, resp.StatusCode)
+		}
+	}
+
+	// relative dsts are under root
+	id := submit(t, ts, "pics")
+	resp = call(t, http.MethodGet, ts.URL+"/jobs/"+id, "", "secret")
+	defer resp.Body.Close()
+	var raw map[string]json.RawMessage
+	json.NewDecoder(resp.Body).Decode(&raw)
+	root := filepath.Dir(dir)
+	if !strings.Contains(string(raw["J"]), filepath.Join(root, "pics")) {
+		t.Fatalf("expected dst under %s, found %s", root, raw["J"])
+	}
+}
@@ -0,0 +1,101 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gotd/td/telegram/downloader"
+	"github.com/gotd/td/tg"
+	"github.com/iyear/tdl/core/dcpool"
+	"github.com/iyear/tdl/core/tclient"
+	"github.com/iyear/tdl/core/tmedia"
+	"github.com/iyear/tdl/core/util/tutil"
+)
+
+// poolSize is number of connections kept per dc, partSize is the max part
+// telegram serves in one request, threads are per file
+const (
+	poolSize = 8
+	threads  = 4
+	partSize = 1024 * 1024
+)
+
+// GetMessage fetches msg of chat again, file references in media expire so
+// media has to be downloaded from a fresh message
+func (t *Telegram) GetMessage(ctx context.Context, chat string, msg int) (*tg.Message, error) {
+	peer, err := tutil.GetInputPeer(ctx, t.manager, chat)
+	if err != nil {
+		return nil, err
+	}
+	return tutil.GetSingleMessage(ctx, t.c.API(), peer.InputPeer(), msg)
+}
+
+// DownloadMedia downloads m from its dc into w, parts are fetched in
+// parallel when w is an io.WriterAt
+func (t *Telegram) DownloadMedia(ctx context.Context, m *tmedia.Media, w io.Writer) (err error) {
+	client := t.getPool(ctx).Client(ctx, m.DC)
+	b := downloader.NewDownloader().WithPartSize(partSize).
+		Download(client, m.InputFileLoc).
+		WithThreads(tutil.BestThreads(m.Size, threads))
+	if wa, ok := w.(io.WriterAt); ok {
+		_, err = b.Parallel(ctx, wa)
+	} else {
+		_, err = b.Stream(ctx, w)
+	}
+	if err != nil {
+		return fmt.Errorf("downloading %s failed %w", m.Name, err)
+	}
+	return nil
+}
+
+func (t *Telegram) getPool(ctx context.Context) dcpool.Pool {
+	defer t.pl.Unlock()
+	t.pl.Lock()
+	if t.pool == nil {
+		t.pool = dcpool.NewPool(t.c, poolSize, tclient.NewDefaultMiddlewares(ctx, reconnectTimeout)...)
+	}
+	return t.pool
+}
+
+// resetPool drops the pool of a client which is replaced on reconnect
+func (t *Telegram) resetPool() {
+	defer t.pl.Unlock()
+	t.pl.Lock()
+	if t.pool != nil {
+		t.pool.Close()
+		t.pool = nil
+	}
+}
+
+// MediaOf returns media of msg, false for text only msgs
+func MediaOf(msg *tg.Message) (*tmedia.Media, bool) {
+	return tmedia.GetMedia(msg)
+}
+
+// MimeOf returns mime of media in msg, photos are always jpeg
+func MimeOf(msg *tg.Message) string {
+	switch m := msg.Media.(type) {
+	case *tg.MessageMediaPhoto:
+		return "image/jpeg"
+	case *tg.MessageMediaDocument:
+		if d, ok := m.Document.(*tg.Document); ok {
+			return d.MimeType
+		}
+	}
+	return ""
+}
+
+const msgLinkPrefix = "https://t.me/c/"
+
+// MsgLink is the t.me link of msg in a private chat or channel
+func MsgLink(chat int64, msg int) string {
+	return fmt.Sprintf("%s%d/%d", msgLinkPrefix, chat, msg)
+}
+
+// IsMsgLink reports if link points to a telegram msg, such items can be
+// forwarded instead of uploaded again
+func IsMsgLink(link string) bool {
+	return strings.HasPrefix(link, msgLinkPrefix)
+}
@@ -0,0 +1,48 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/shivamhw/content-pirate/pkg/log"
+)
+
+// clients keeps one client per phone number, the session store of a phone
+// can only be opened once in a process
+var clients = struct {
+	l sync.Mutex
+	c map[string]*Telegram
+}{
+	c: make(map[string]*Telegram),
+}
+
+// GetClient returns the shared client of phone, creating it on first use
+func GetClient(ctx context.Context, phone string) (*Telegram, error) {
+	defer clients.l.Unlock()
+	clients.l.Lock()
+	if t, ok := clients.c[phone]; ok {
+		return t, nil
+	}
+	t, err := NewTelegram(ctx, &UserData{
+		PhoneNumber: phone,
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("created telegram client", "user", phone)
+	clients.c[phone] = t
+	return t, nil
+}
+
+// GetAuthorizedClient is GetClient which fails if phone is not logged in
+func GetAuthorizedClient(ctx context.Context, phone string) (*Telegram, error) {
+	t, err := GetClient(ctx, phone)
+	if err != nil {
+		return nil, err
+	}
+	if st, err := t.WhoAmI(); err != nil || !st.Authorized {
+		return nil, fmt.Errorf("user not logged in %s", phone)
+	}
+	return t, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math/rand"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gotd/contrib/bg"
@@ -12,6 +13,7 @@ import (
 	"github.com/gotd/td/telegram/auth"
 	"github.com/gotd/td/telegram/peers"
 	"github.com/gotd/td/tg"
+	"github.com/iyear/tdl/core/dcpool"
 	"github.com/iyear/tdl/core/logctx"
 	"github.com/iyear/tdl/core/storage"
 	"github.com/iyear/tdl/core/tmedia"
@@ -27,8 +29,12 @@ type Telegram struct {
 	close   *bg.StopFunc
 	manager *peers.Manager
 	store   *Store
+	pl      sync.Mutex
+	pool    dcpool.Pool
 }
 
+const reconnectTimeout = 5 * time.Second
+
 type UserData struct {
 	PhoneNumber string
 	Store       *Store
@@ -85,6 +91,7 @@ func (t *Telegram) heartBeat() error {
 						log.Errorf("heatbeat", "reconnect failed with telegram")
 					}
 					// (*t.close)()
+					t.resetPool()
 					t.c = c
 					t.close = stop
 					t.manager = peers.Options{Storage: storage.NewPeers(t.store.Kvd)}.Build(c.API())
@@ -108,7 +115,7 @@ func GetClientWithStore(ctx context.Context, store *Store) (*telegram.Client, *b
 	c, err := tclient.New(ctx, tclient.Options{
 		KV:               store.Kvd,
 		UpdateHandler:    nil,
-		ReconnectTimeout: 5 * time.Second,
+		ReconnectTimeout: reconnectTimeout,
 	}, false)
 	if err != nil {
 		return nil, nil, err
@@ -0,0 +1,190 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"mime"
+	"os"
+	"path/filepath"
+
+	"github.com/gotd/td/telegram/uploader"
+	"github.com/gotd/td/tg"
+	"github.com/iyear/tdl/core/util/tutil"
+	"github.com/shivamhw/content-pirate/pkg/log"
+)
+
+type MediaKind int
+
+const (
+	MediaDocument MediaKind = iota
+	MediaPhoto
+	MediaVideo
+)
+
+// max caption of media msgs and max msgs in one album
+const (
+	maxCaption = 1024
+	maxAlbum   = 10
+)
+
+// Media is a local file to upload, Name is the file name shown in chat
+type Media struct {
+	Name string
+	Kind MediaKind
+	Path string
+}
+
+// UploadedMedia is media already on telegram servers which can be sent in
+// albums
+type UploadedMedia = tg.InputMediaClass
+
+// SendMedia uploads media to chat with caption, more than one media is sent
+// as albums of up to 10 items
+func (t *Telegram) SendMedia(to string, caption string, media ...Media) (msgs []*tg.Message, err error) {
+	if len(media) == 0 {
+		return nil, fmt.Errorf("no media to send")
+	}
+	if len(media) > 1 {
+		var album []UploadedMedia
+		for _, m := range media {
+			in, err := t.UploadAlbumItem(to, m)
+			if err != nil {
+				return nil, err
+			}
+			album = append(album, in)
+		}
+		return t.SendAlbum(to, caption, album)
+	}
+	peer, err := tutil.GetInputPeer(t.ctx, t.manager, to)
+	if err != nil {
+		return nil, err
+	}
+	in, err := t.uploadMedia(t.ctx, media[0])
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.c.API().MessagesSendMedia(t.ctx, &tg.MessagesSendMediaRequest{
+		Peer:     peer.InputPeer(),
+		Media:    in,
+		Message:  trimCaption(caption),
+		RandomID: rand.Int63(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []*tg.Message{extractSentMessage(resp)}, nil
+}
+
+// SendAlbum sends uploaded media as albums of up to 10 items, caption is set
+// on the first album
+func (t *Telegram) SendAlbum(to string, caption string, media []UploadedMedia) (msgs []*tg.Message, err error) {
+	peer, err := tutil.GetInputPeer(t.ctx, t.manager, to)
+	if err != nil {
+		return nil, err
+	}
+	caption = trimCaption(caption)
+	for start := 0; start < len(media); start += maxAlbum {
+		end := min(start+maxAlbum, len(media))
+		var album []tg.InputSingleMedia
+		for n, in := range media[start:end] {
+			single := tg.InputSingleMedia{
+				Media:    in,
+				RandomID: rand.Int63(),
+			}
+			// telegram shows caption of first item as album caption
+			if start == 0 && n == 0 {
+				single.Message = caption
+			}
+			album = append(album, single)
+		}
+		resp, err := t.c.API().MessagesSendMultiMedia(t.ctx, &tg.MessagesSendMultiMediaRequest{
+			Peer:       peer.InputPeer(),
+			MultiMedia: album,
+		})
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, extractSentMessage(resp))
+		log.Debugf("sent album", "to", to, "items", len(album))
+	}
+	return msgs, nil
+}
+
+func (t *Telegram) uploadMedia(ctx context.Context, m Media) (tg.InputMediaClass, error) {
+	f, err := os.Open(m.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	in, err := uploader.NewUploader(t.c.API()).Upload(ctx, uploader.NewUpload(m.Name, f, info.Size()))
+	if err != nil {
+		return nil, fmt.Errorf("uploading %s failed %w", m.Name, err)
+	}
+	if m.Kind == MediaPhoto {
+		return &tg.InputMediaUploadedPhoto{File: in}, nil
+	}
+	doc := &tg.InputMediaUploadedDocument{
+		File:     in,
+		MimeType: mimeOf(m.Name),
+		Attributes: []tg.DocumentAttributeClass{
+			&tg.DocumentAttributeFilename{FileName: m.Name},
+		},
+	}
+	if m.Kind == MediaVideo {
+		doc.Attributes = append(doc.Attributes, &tg.DocumentAttributeVideo{
+			SupportsStreaming: true,
+		})
+	}
+	return doc, nil
+}
+
+// UploadAlbumItem uploads media to telegram servers, albums only accept
+// media which is already uploaded
+func (t *Telegram) UploadAlbumItem(to string, m Media) (UploadedMedia, error) {
+	peer, err := tutil.GetInputPeer(t.ctx, t.manager, to)
+	if err != nil {
+		return nil, err
+	}
+	in, err := t.uploadMedia(t.ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.c.API().MessagesUploadMedia(t.ctx, &tg.MessagesUploadMediaRequest{
+		Peer:  peer.InputPeer(),
+		Media: in,
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch v := res.(type) {
+	case *tg.MessageMediaPhoto:
+		if p, ok := v.Photo.(*tg.Photo); ok {
+			return &tg.InputMediaPhoto{ID: p.AsInput()}, nil
+		}
+	case *tg.MessageMediaDocument:
+		if d, ok := v.Document.(*tg.Document); ok {
+			return &tg.InputMediaDocument{ID: d.AsInput()}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected uploaded media %T for %s", res, m.Name)
+}
+
+func mimeOf(name string) string {
+	if m := mime.TypeByExtension(filepath.Ext(name)); m != "" {
+		return m
+	}
+	return "application/octet-stream"
+}
+
+func trimCaption(c string) string {
+	r := []rune(c)
+	if len(r) > maxCaption {
+		return string(r[:maxCaption])
+	}
+	return c
+}
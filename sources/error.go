@@ -0,0 +1,13 @@
+package sources
+
+import "fmt"
+
+// HttpError is returned when a media host answers with a non 200 code
+type HttpError struct {
+	Url  string
+	Code int
+}
+
+func (e *HttpError) Error() string {
+	return fmt.Sprintf("failed to download %s, status code %d", e.Url, e.Code)
+}
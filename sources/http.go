@@ -0,0 +1,43 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// get requests u with headers h, non 200 answers are HttpError
+func get(ctx context.Context, u string, h ...http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range h {
+		for k, v := range h {
+			req.Header[k] = v
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s because %w", u, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &HttpError{Url: u, Code: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+// getJSON decodes json answer of u into v
+func getJSON(ctx context.Context, u string, h http.Header, v any) error {
+	resp, err := get(ctx, u, h)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decoding answer of %s failed %w", u, err)
+	}
+	return nil
+}
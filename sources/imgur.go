@@ -0,0 +1,109 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/shivamhw/content-pirate/commons"
+)
+
+// ImgurResolver resolves imgur images, gifv and albums. Albums need a client
+// id of the imgur api, IMGUR_CLIENT_ID by default.
+type ImgurResolver struct {
+	API      string
+	CDN      string
+	ClientID string
+}
+
+type imgurImage struct {
+	Link     string `json:"link"`
+	Animated bool   `json:"animated"`
+	MP4      string `json:"mp4"`
+}
+
+func NewImgurResolver() *ImgurResolver {
+	return &ImgurResolver{
+		API:      "https://api.imgur.com/3",
+		CDN:      "https://i.imgur.com",
+		ClientID: os.Getenv("IMGUR_CLIENT_ID"),
+	}
+}
+
+func (r *ImgurResolver) Match(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	return host == "imgur.com" || strings.HasSuffix(host, ".imgur.com")
+}
+
+func (r *ImgurResolver) Resolve(ctx context.Context, u *url.URL) ([]Media, error) {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	switch {
+	case len(parts) == 2 && (parts[0] == "a" || parts[0] == "gallery"):
+		return r.album(ctx, slugId(parts[1]))
+	case len(parts) == 1 && parts[0] != "":
+		id, ext, _ := strings.Cut(parts[0], ".")
+		switch {
+		case ext == "gifv":
+			return []Media{{URL: fmt.Sprintf("%s/%s.mp4", r.CDN, id), Type: commons.VID_TYPE, Ext: "mp4"}}, nil
+		case ext != "":
+			if m, ok := mediaOf(u.String()); ok {
+				return []Media{m}, nil
+			}
+		case r.ClientID != "":
+			var img imgurImage
+			if err := r.call(ctx, "image/"+id, &img); err != nil {
+				return nil, err
+			}
+			return r.media([]imgurImage{img}), nil
+		default:
+			// the cdn serves every image as jpg
+			return []Media{{URL: fmt.Sprintf("%s/%s.jpg", r.CDN, id), Type: commons.IMG_TYPE, Ext: "jpg"}}, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported imgur link %s", u)
+}
+
+func (r *ImgurResolver) album(ctx context.Context, id string) ([]Media, error) {
+	if r.ClientID == "" {
+		return nil, fmt.Errorf("imgur album %s needs IMGUR_CLIENT_ID", id)
+	}
+	var imgs []imgurImage
+	if err := r.call(ctx, "album/"+id+"/images", &imgs); err != nil {
+		return nil, err
+	}
+	return r.media(imgs), nil
+}
+
+func (r *ImgurResolver) call(ctx context.Context, endpoint string, data any) error {
+	h := http.Header{}
+	h.Set("Authorization", "Client-ID "+r.ClientID)
+	resp := struct {
+		Data any `json:"data"`
+	}{Data: data}
+	return getJSON(ctx, r.API+"/"+endpoint, h, &resp)
+}
+
+// media prefers mp4 of animated images, gifs of imgur are huge
+func (r *ImgurResolver) media(imgs []imgurImage) (res []Media) {
+	for _, img := range imgs {
+		link := img.Link
+		if img.Animated && img.MP4 != "" {
+			link = img.MP4
+		}
+		if m, ok := mediaOf(link); ok {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// slugId is id of a gallery link, new links put a title before it
+func slugId(s string) string {
+	if n := strings.LastIndex(s, "-"); n >= 0 {
+		return s[n+1:]
+	}
+	return s
+}
@@ -23,6 +23,14 @@ type Post struct {
 	SourceAc  string
 	Ext       string
 	FileName  string
+	Author    string
+	Date      time.Time
+	Score     int
+	Permalink string
+	Meta      map[string]string // source specific metadata, e.g. subreddit
+	GroupId   string // post id of gallery items
+	GroupSize int
+	GroupIdx  int
 }
 
 type ScrapeOpts struct {
@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/shivamhw/content-pirate/commons"
@@ -19,6 +19,7 @@ type RedditStore struct {
 
 type RedditStoreOpts struct {
 	reddit.RedditClientOpts
+	TmpDir string // dir for streams of videos being muxed, os temp dir if empty
 }
 
 func NewRedditStore(ctx context.Context, opts *RedditStoreOpts) (*RedditStore, error) {
@@ -34,7 +35,7 @@ func NewRedditStore(ctx context.Context, opts *RedditStoreOpts) (*RedditStore, e
 	}, nil
 }
 
-func (r *RedditStore) ScrapePosts(_ context.Context, subreddit string, opts ScrapeOpts) (p chan Post, err error) {
+func (r *RedditStore) ScrapePosts(ctx context.Context, subreddit string, opts ScrapeOpts) (p chan Post, err error) {
 	p = make(chan Post, 5)
 	cnt := 0
 	rOpts := reddit.ListOptions{
@@ -47,13 +48,14 @@ func (r *RedditStore) ScrapePosts(_ context.Context, subreddit string, opts Scra
 	rposts, err := r.client.GetPosts(subreddit, rOpts)
 	if err != nil {
 		log.Errorf("scrapping subreddit failed ", "subreddit", subreddit, "error", err)
+		return nil, err
 	}
 	go func() {
 		defer func() {
 			close(p)
 			log.Infof("scrapping post completed", "subreddit", subreddit, "scraped posts", cnt)
 		}()
-		posts := r.convertToPosts(rposts, subreddit, opts)
+		posts := r.convertToPosts(ctx, rposts, subreddit, opts)
 		for _, post := range posts {
 			p <- post
 			cnt++
@@ -62,16 +64,17 @@ func (r *RedditStore) ScrapePosts(_ context.Context, subreddit string, opts Scra
 	return p, nil
 }
 
-func (r *RedditStore) convertToPosts(rposts []*reddit.Post, subreddit string, opts ScrapeOpts) (posts []Post) {
+func (r *RedditStore) convertToPosts(ctx context.Context, rposts []*reddit.Post, subreddit string, opts ScrapeOpts) (posts []Post) {
 	for _, post := range rposts {
 		// if gallary link
 		if strings.Contains(post.URL, "/gallery/") {
 			log.Debugf("found gallery", "url", post.URL)
+			var gallery []Post
 			for _, item := range post.GalleryData.Items {
 				link := fmt.Sprintf("https://i.redd.it/%s.%s", item.MediaID, commons.GetMIME(post.MediaMetadata[item.MediaID].MIME))
 				log.Debugf("created", "link", link, "post title", post.Title, "mediaId", item.MediaID)
 				if commons.IsImgLink(link) {
-					post := Post{
+					p := Post{
 						Id:        fmt.Sprintf("%d", item.ID),
 						Title:     post.Title, //fmt.Sprintf("%s_GAL_%s", post.Title, item.MediaID[:len(item.MediaID)-3]),
 						MediaType: commons.IMG_TYPE,
@@ -79,14 +82,21 @@ func (r *RedditStore) convertToPosts(rposts []*reddit.Post, subreddit string, op
 						SrcLink:   link,
 						SourceAc:  subreddit,
 						FileName: fmt.Sprintf("%d.%s", item.ID, commons.GetMIME(post.MediaMetadata[item.MediaID].MIME)),
+						GroupId:   post.ID,
+						GroupIdx:  len(gallery),
 					}
-					posts = append(posts, post)
+					withMeta(&p, post)
+					gallery = append(gallery, p)
 					if opts.SkipCollection {
 						log.Infof("not downloading full collection")
 						break
 					}
 				}
 			}
+			for n := range gallery {
+				gallery[n].GroupSize = len(gallery)
+			}
+			posts = append(posts, gallery...)
 			continue
 		}
 		// if single img post
@@ -99,6 +109,7 @@ func (r *RedditStore) convertToPosts(rposts []*reddit.Post, subreddit string, op
 				Ext:       commons.GetExtFromLink(post.URL),
 				MediaType: commons.IMG_TYPE,
 			}
+			withMeta(&p, post)
 			posts = append(posts, p)
 			continue
 		}
@@ -111,26 +122,92 @@ func (r *RedditStore) convertToPosts(rposts []*reddit.Post, subreddit string, op
 				Ext:       "mp4",
 				SourceAc:  subreddit,
 			}
+			withMeta(&p, post)
+			if post.Media.RedditVideo.DashURL != "" {
+				p.Meta[dashMetaKey] = post.Media.RedditVideo.DashURL
+			}
 			posts = append(posts, p)
 			continue
 		}
+		if !post.IsSelfPost && post.URL != "" {
+			posts = append(posts, r.resolvePost(ctx, post, subreddit, opts)...)
+		}
 	}
 	return
 }
 
-func (r *RedditStore) DownloadItem(ctx context.Context, i *commons.Item) (error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, i.Src, nil)
+// resolvePost returns posts of media behind link of post, links with many
+// media are grouped like galleries
+func (r *RedditStore) resolvePost(ctx context.Context, post *reddit.Post, subreddit string, opts ScrapeOpts) (posts []Post) {
+	media, err := ResolveMedia(ctx, post.URL)
 	if err != nil {
-		return err
+		log.Warnf("resolving link post failed", "url", post.URL, "err", err)
+		return nil
+	}
+	for _, m := range media {
+		if opts.SkipVideos && m.Type == commons.VID_TYPE {
+			continue
+		}
+		p := Post{
+			Id:        post.ID,
+			Title:     post.Title,
+			MediaType: m.Type,
+			SrcLink:   m.URL,
+			Ext:       m.Ext,
+			SourceAc:  subreddit,
+		}
+		withMeta(&p, post)
+		posts = append(posts, p)
+		if opts.SkipCollection {
+			break
+		}
+	}
+	if len(posts) > 1 {
+		for n := range posts {
+			posts[n].Id = fmt.Sprintf("%s_%d", post.ID, n)
+			posts[n].GroupId = post.ID
+			posts[n].GroupIdx = n
+			posts[n].GroupSize = len(posts)
+		}
 	}
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download %s because %s code", i.Src, err)
+	return posts
+}
+
+// withMeta copies metadata of reddit post to p
+func withMeta(p *Post, post *reddit.Post) {
+	p.Author = post.Author
+	p.Score = post.Score
+	if post.Created != nil {
+		p.Date = post.Created.Time
+	}
+	if post.Permalink != "" {
+		p.Permalink = "https://www.reddit.com" + post.Permalink
+	}
+	p.Meta = map[string]string{
+		"subreddit":    post.SubredditName,
+		"upvote_ratio": strconv.FormatFloat(float64(post.UpvoteRatio), 'f', 2, 64),
+		"comments":     strconv.Itoa(post.NumberOfComments),
+		"nsfw":         strconv.FormatBool(post.NSFW),
+	}
+	if post.Body != "" {
+		p.Meta["body"] = post.Body
+	}
+}
+
+func (r *RedditStore) DownloadItem(ctx context.Context, i *commons.Item, w io.Writer) error {
+	if i.Type == commons.VID_TYPE {
+		if ok, err := downloadVideo(ctx, i, w, r.opts.TmpDir); ok || err != nil {
+			return err
+		}
+	}
+	resp, err := get(ctx, i.Src)
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
-	i.Data, err = io.ReadAll(resp.Body)
+	_, err = io.Copy(w, resp.Body)
 	if err != nil {
-		return  fmt.Errorf("error downloading job %s err %s", i.Src, err.Error())
+		return  fmt.Errorf("error downloading job %s err %w", i.Src, err)
 	}
 	return nil
 }
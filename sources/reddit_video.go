@@ -0,0 +1,119 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+
+	"github.com/shivamhw/content-pirate/commons"
+	"github.com/shivamhw/content-pirate/pkg/dash"
+	"github.com/shivamhw/content-pirate/pkg/log"
+)
+
+// dashMetaKey keeps dash manifest of a reddit video in Item.Meta
+const dashMetaKey = "dash_url"
+
+// dashURL is manifest of a reddit video, derived from the fallback stream
+// for items scraped without it
+func dashURL(i *commons.Item) string {
+	if u := i.Meta[dashMetaKey]; u != "" {
+		return u
+	}
+	u, err := url.Parse(i.Src)
+	if err != nil || u.Host != "v.redd.it" {
+		return ""
+	}
+	u.Path = path.Join(path.Dir(u.Path), "DASHPlaylist.mpd")
+	u.RawQuery = ""
+	return u.String()
+}
+
+// downloadVideo writes best video stream of the dash manifest of item with
+// best audio stream muxed in. Videos without audio are written silent, nothing
+// is written to w if the manifest can't be used so callers can fall back to
+// Item.Src. Streams are downloaded to tmpDir.
+func downloadVideo(ctx context.Context, i *commons.Item, w io.Writer, tmpDir string) (ok bool, err error) {
+	manifest := dashURL(i)
+	if manifest == "" {
+		return false, nil
+	}
+	resp, err := get(ctx, manifest)
+	if err != nil {
+		log.Warnf("fetching dash manifest failed, downloading silent video", "item", i.Id, "err", err)
+		return false, nil
+	}
+	m, err := dash.ParseMPD(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		log.Warnf("dash manifest unusable, downloading silent video", "item", i.Id, "err", err)
+		return false, nil
+	}
+	video, audio, err := m.Best(manifest)
+	if err != nil {
+		log.Warnf("dash manifest unusable, downloading silent video", "item", i.Id, "err", err)
+		return false, nil
+	}
+	v, vSize, err := downloadTemp(ctx, video.URL, tmpDir)
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) {
+		log.Warnf("downloading dash video failed, downloading silent video", "item", i.Id, "err", err)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer dropTemp(v)
+	if audio == nil {
+		log.Debugf("video has no audio", "item", i.Id)
+		_, err = io.Copy(w, v)
+		return true, err
+	}
+	a, aSize, err := downloadTemp(ctx, audio.URL, tmpDir)
+	if errors.As(err, &httpErr) {
+		// some videos list an audio stream which was never transcoded
+		log.Warnf("downloading audio failed, writing silent video", "item", i.Id, "err", err)
+		_, err = io.Copy(w, v)
+		return true, err
+	}
+	if err != nil {
+		return false, err
+	}
+	defer dropTemp(a)
+	err = dash.Mux(w, io.NewSectionReader(v, 0, vSize), io.NewSectionReader(a, 0, aSize))
+	if errors.Is(err, dash.ErrUnsupported) {
+		log.Warnf("muxing audio failed, writing silent video", "item", i.Id, "err", err)
+		_, err = io.Copy(w, v)
+	}
+	return true, err
+}
+
+// downloadTemp downloads u to a temp file in dir, rewound for reading
+func downloadTemp(ctx context.Context, u string, dir string) (*os.File, int64, error) {
+	resp, err := get(ctx, u)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	f, err := os.CreateTemp(dir, "dash-*.mp4")
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := io.Copy(f, resp.Body)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		dropTemp(f)
+		return nil, 0, fmt.Errorf("error downloading %s err %w", u, err)
+	}
+	return f, size, nil
+}
+
+func dropTemp(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
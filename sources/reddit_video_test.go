@@ -0,0 +1,88 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/shivamhw/content-pirate/commons"
+)
+
+// manifest with relative streams like the ones of v.redd.it
+const testMPD = `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" mediaPresentationDuration="PT12.5S" type="static">
+  <Period duration="PT12.5S">
+    <AdaptationSet contentType="video" id="0">
+      <Representation bandwidth="2400000" codecs="avc1.4d401f" height="720" id="VIDEO-1" mimeType="video/mp4" width="1280">
+        <BaseURL>DASH_720.mp4</BaseURL>
+      </Representation>
+    </AdaptationSet>
+    <AdaptationSet contentType="audio" id="1">
+      <Representation bandwidth="128000" codecs="mp4a.40.2" id="AUDIO-1" mimeType="audio/mp4">
+        <BaseURL>DASH_AUDIO_128.mp4</BaseURL>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+func videoItem(srv *httptest.Server, manifest string) *commons.Item {
+	i := &commons.Item{Id: "v1", Type: commons.VID_TYPE, Src: srv.URL + "/abc/DASH_360.mp4", Meta: map[string]string{}}
+	if manifest != "" {
+		i.Meta[dashMetaKey] = srv.URL + manifest
+	}
+	return i
+}
+
+func TestDownloadVideoFallbacks(t *testing.T) {
+	tmp := t.TempDir()
+	var requests int
+	var tempsDuringAudio []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/abc/DASHPlaylist.mpd":
+			fmt.Fprint(w, testMPD)
+		case "/abc/DASH_720.mp4":
+			fmt.Fprint(w, "video")
+		case "/abc/DASH_AUDIO_128.mp4":
+			// video is being held in the configured dir
+			tempsDuringAudio, _ = filepath.Glob(filepath.Join(tmp, "dash-*.mp4"))
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	// no manifest
+	var out bytes.Buffer
+	ok, err := downloadVideo(ctx, videoItem(srv, "/gone/DASHPlaylist.mpd"), &out, tmp)
+	if ok || err != nil || out.Len() != 0 {
+		t.Fatalf("expected fall back for missing manifest, found %v %v %q", ok, err, out.String())
+	}
+
+	// audio forbidden
+	ok, err = downloadVideo(ctx, videoItem(srv, "/abc/DASHPlaylist.mpd"), &out, tmp)
+	if !ok || err != nil || out.String() != "video" {
+		t.Fatalf("expected silent video, found %v %v %q", ok, err, out.String())
+	}
+	if len(tempsDuringAudio) != 1 {
+		t.Fatalf("expected video stream in %s, found %v", tmp, tempsDuringAudio)
+	}
+	if left, _ := filepath.Glob(filepath.Join(tmp, "*")); len(left) != 0 {
+		t.Fatalf("expected temp files removed, found %v", left)
+	}
+
+	// host other than v.redd.it without manifest in meta
+	requests = 0
+	out.Reset()
+	ok, err = downloadVideo(ctx, videoItem(srv, ""), &out, tmp)
+	if ok || err != nil || out.Len() != 0 || requests != 0 {
+		t.Fatalf("expected fall back without requests, found %v %v %q after %d requests", ok, err, out.String(), requests)
+	}
+}
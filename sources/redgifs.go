@@ -0,0 +1,94 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+)
+
+// RedgifsResolver resolves redgifs links with a temporary token of the api,
+// the token is fetched again when it expires
+type RedgifsResolver struct {
+	API string
+
+	l     sync.Mutex
+	token string
+}
+
+type redgifsGif struct {
+	Gif struct {
+		Urls struct {
+			HD string `json:"hd"`
+			SD string `json:"sd"`
+		} `json:"urls"`
+	} `json:"gif"`
+}
+
+func NewRedgifsResolver() *RedgifsResolver {
+	return &RedgifsResolver{API: "https://api.redgifs.com/v2"}
+}
+
+func (r *RedgifsResolver) Match(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	return host == "redgifs.com" || strings.HasSuffix(host, ".redgifs.com")
+}
+
+func (r *RedgifsResolver) Resolve(ctx context.Context, u *url.URL) ([]Media, error) {
+	if m, ok := mediaOf(u.String()); ok {
+		return []Media{m}, nil
+	}
+	// watch/<id>, ifr/<id>, <id>
+	id := strings.ToLower(path.Base(strings.TrimSuffix(u.Path, "/")))
+	if id == "" || id == "." || id == "/" {
+		return nil, fmt.Errorf("unsupported redgifs link %s", u)
+	}
+	var gif redgifsGif
+	err := r.call(ctx, "gifs/"+id, &gif, false)
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) && httpErr.Code == http.StatusUnauthorized {
+		err = r.call(ctx, "gifs/"+id, &gif, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	link := gif.Gif.Urls.HD
+	if link == "" {
+		link = gif.Gif.Urls.SD
+	}
+	m, ok := mediaOf(link)
+	if !ok {
+		return nil, fmt.Errorf("redgifs %s has no media", id)
+	}
+	return []Media{m}, nil
+}
+
+func (r *RedgifsResolver) call(ctx context.Context, endpoint string, data any, refresh bool) error {
+	token, err := r.getToken(ctx, refresh)
+	if err != nil {
+		return err
+	}
+	h := http.Header{}
+	h.Set("Authorization", "Bearer "+token)
+	return getJSON(ctx, r.API+"/"+endpoint, h, data)
+}
+
+func (r *RedgifsResolver) getToken(ctx context.Context, refresh bool) (string, error) {
+	defer r.l.Unlock()
+	r.l.Lock()
+	if r.token != "" && !refresh {
+		return r.token, nil
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := getJSON(ctx, r.API+"/auth/temporary", nil, &resp); err != nil {
+		return "", err
+	}
+	r.token = resp.Token
+	return r.token, nil
+}
@@ -0,0 +1,78 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Factory creates a source from its config, cfg is nil when no config is passed
+type Factory func(ctx context.Context, cfg any) (Source, error)
+
+var (
+	registry = make(map[SourceType]Factory)
+	regL     sync.RWMutex
+)
+
+func init() {
+	Register(SOURCE_TYPE_REDDIT, func(ctx context.Context, cfg *RedditStoreOpts) (Source, error) {
+		return NewRedditStore(ctx, cfg)
+	})
+	Register(SOURCE_TYPE_TELEGRAM, func(ctx context.Context, cfg *TelegramSourceOtps) (Source, error) {
+		return NewTelegramSource(ctx, cfg)
+	})
+}
+
+// Register adds a source type, cfg passed to New must be a *C, a C or json
+// of C. Registering a type again replaces it.
+func Register[C any](typ SourceType, f func(ctx context.Context, cfg *C) (Source, error)) {
+	defer regL.Unlock()
+	regL.Lock()
+	registry[typ] = func(ctx context.Context, cfg any) (Source, error) {
+		c, err := toCfg[C](cfg)
+		if err != nil {
+			return nil, fmt.Errorf("bad config for source %s: %w", typ, err)
+		}
+		return f(ctx, c)
+	}
+}
+
+func New(ctx context.Context, typ SourceType, cfg any) (Source, error) {
+	regL.RLock()
+	f, ok := registry[typ]
+	regL.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown source store %s", typ)
+	}
+	return f(ctx, cfg)
+}
+
+func Registered() (types []SourceType) {
+	defer regL.RUnlock()
+	regL.RLock()
+	for t := range registry {
+		types = append(types, t)
+	}
+	return
+}
+
+func toCfg[C any](cfg any) (*C, error) {
+	switch c := cfg.(type) {
+	case nil:
+		return new(C), nil
+	case *C:
+		return c, nil
+	case C:
+		return &c, nil
+	case json.RawMessage:
+		v := new(C)
+		err := json.Unmarshal(c, v)
+		return v, err
+	case []byte:
+		v := new(C)
+		err := json.Unmarshal(c, v)
+		return v, err
+	}
+	return nil, fmt.Errorf("expected %T got %T", new(C), cfg)
+}
@@ -0,0 +1,102 @@
+package sources
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/shivamhw/content-pirate/commons"
+)
+
+// Media is a direct link to a media file found behind a post url
+type Media struct {
+	URL  string
+	Type commons.MediaType
+	Ext  string
+}
+
+// Resolver maps url of a link post to direct media urls
+type Resolver interface {
+	// Match reports if the resolver handles u
+	Match(u *url.URL) bool
+	Resolve(ctx context.Context, u *url.URL) ([]Media, error)
+}
+
+var (
+	resolvers []Resolver
+	resL      sync.RWMutex
+)
+
+func init() {
+	RegisterResolver(DirectResolver{})
+	RegisterResolver(NewImgurResolver())
+	RegisterResolver(NewRedgifsResolver())
+}
+
+// RegisterResolver adds a resolver, resolvers registered later are asked
+// first so they can take over hosts of the built in ones
+func RegisterResolver(r Resolver) {
+	defer resL.Unlock()
+	resL.Lock()
+	resolvers = append(resolvers, r)
+}
+
+// ResolveMedia returns media behind link with the first resolver matching
+// it, nil if no resolver matches
+func ResolveMedia(ctx context.Context, link string) ([]Media, error) {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, nil
+	}
+	resL.RLock()
+	var r Resolver
+	for n := len(resolvers) - 1; n >= 0; n-- {
+		if resolvers[n].Match(u) {
+			r = resolvers[n]
+			break
+		}
+	}
+	resL.RUnlock()
+	if r == nil {
+		return nil, nil
+	}
+	return r.Resolve(ctx, u)
+}
+
+var mediaExts = map[string]commons.MediaType{
+	"jpg":  commons.IMG_TYPE,
+	"jpeg": commons.IMG_TYPE,
+	"png":  commons.IMG_TYPE,
+	"gif":  commons.IMG_TYPE,
+	"webp": commons.IMG_TYPE,
+	"mp4":  commons.VID_TYPE,
+	"webm": commons.VID_TYPE,
+	"mov":  commons.VID_TYPE,
+}
+
+// mediaOf is media of a direct link, ok is false if ext of link isn't media
+func mediaOf(link string) (m Media, ok bool) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return m, false
+	}
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(u.Path), "."))
+	typ, ok := mediaExts[ext]
+	return Media{URL: link, Type: typ, Ext: ext}, ok
+}
+
+// DirectResolver handles links to media files of any host, query strings
+// are kept
+type DirectResolver struct{}
+
+func (DirectResolver) Match(u *url.URL) bool {
+	_, ok := mediaOf(u.String())
+	return ok
+}
+
+func (DirectResolver) Resolve(_ context.Context, u *url.URL) ([]Media, error) {
+	m, _ := mediaOf(u.String())
+	return []Media{m}, nil
+}
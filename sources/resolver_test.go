@@ -0,0 +1,104 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/shivamhw/content-pirate/commons"
+)
+
+func mustURL(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestDirectResolver(t *testing.T) {
+	got, err := ResolveMedia(context.Background(), "https://preview.redd.it/abc.jpeg?width=640&s=x")
+	want := []Media{{URL: "https://preview.redd.it/abc.jpeg?width=640&s=x", Type: commons.IMG_TYPE, Ext: "jpeg"}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, found %v %v", want, got, err)
+	}
+	if got, err := ResolveMedia(context.Background(), "https://example.com/article"); got != nil || err != nil {
+		t.Fatalf("expected no media for article, found %v %v", got, err)
+	}
+}
+
+func TestImgurResolver(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Client-ID cid" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/album/AbC12/images":
+			fmt.Fprint(w, `{"data":[
+				{"link":"https://i.imgur.com/one.png","animated":false},
+				{"link":"https://i.imgur.com/two.gif","animated":true,"mp4":"https://i.imgur.com/two.mp4"}
+			],"success":true,"status":200}`)
+		case "/image/xyz":
+			fmt.Fprint(w, `{"data":{"link":"https://i.imgur.com/xyz.jpg"},"success":true,"status":200}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	r := &ImgurResolver{API: srv.URL, CDN: "https://i.imgur.com", ClientID: "cid"}
+	cases := map[string][]Media{
+		"https://imgur.com/gallery/funny-cats-AbC12": {
+			{URL: "https://i.imgur.com/one.png", Type: commons.IMG_TYPE, Ext: "png"},
+			{URL: "https://i.imgur.com/two.mp4", Type: commons.VID_TYPE, Ext: "mp4"},
+		},
+		"https://imgur.com/xyz":         {{URL: "https://i.imgur.com/xyz.jpg", Type: commons.IMG_TYPE, Ext: "jpg"}},
+		"https://i.imgur.com/clip.gifv": {{URL: "https://i.imgur.com/clip.mp4", Type: commons.VID_TYPE, Ext: "mp4"}},
+		"https://i.imgur.com/pic.png?1": {{URL: "https://i.imgur.com/pic.png?1", Type: commons.IMG_TYPE, Ext: "png"}},
+	}
+	for link, want := range cases {
+		u := mustURL(t, link)
+		if !r.Match(u) {
+			t.Fatalf("%s: not matched", link)
+		}
+		got, err := r.Resolve(context.Background(), u)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: expected %v, found %v %v", link, want, got, err)
+		}
+	}
+}
+
+func TestRedgifsResolver(t *testing.T) {
+	tokens := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/auth/temporary":
+			tokens++
+			fmt.Fprintf(w, `{"token":"t%d"}`, tokens)
+		case "/gifs/happyfunnydog":
+			// first token expired
+			if r.Header.Get("Authorization") != "Bearer t2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"gif":{"id":"happyfunnydog","urls":{"sd":"https://media.redgifs.com/HappyFunnyDog-mobile.mp4","hd":"https://media.redgifs.com/HappyFunnyDog.mp4"}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	r := &RedgifsResolver{API: srv.URL}
+	u := mustURL(t, "https://www.redgifs.com/watch/HappyFunnyDog")
+	if !r.Match(u) {
+		t.Fatalf("redgifs link not matched")
+	}
+	got, err := r.Resolve(context.Background(), u)
+	want := []Media{{URL: "https://media.redgifs.com/HappyFunnyDog.mp4", Type: commons.VID_TYPE, Ext: "mp4"}}
+	if err != nil || !reflect.DeepEqual(got, want) || tokens != 2 {
+		t.Fatalf("expected %v with refreshed token, found %v %v after %d tokens", want, got, err, tokens)
+	}
+}
@@ -2,12 +2,16 @@ package sources
 
 import (
 	"context"
+	"io"
+
 	"github.com/shivamhw/content-pirate/commons"
 )
 
 
 
+// Source scrapes posts of an account and streams content of an item into
+// the writer, writer is an *os.File when downloaded by the scrapper
 type Source interface {
 	ScrapePosts(context.Context, string, ScrapeOpts) (chan Post, error)
-	DownloadItem(context.Context, *commons.Item) (error)
+	DownloadItem(context.Context, *commons.Item, io.Writer) (error)
 }
@@ -3,7 +3,13 @@ package sources
 import (
 	"context"
 	"fmt"
+	"io"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
 
 	"github.com/shivamhw/content-pirate/commons"
 	"github.com/shivamhw/content-pirate/pkg/log"
@@ -20,18 +26,11 @@ type TelegramSource struct {
 }
 
 func NewTelegramSource(ctx context.Context, cfg *TelegramSourceOtps) (*TelegramSource, error) {
-	user := &telegram.UserData{
-		PhoneNumber: cfg.PhoneNumber,
-	}
-	t, err := telegram.NewTelegram(ctx, user)
+	t, err := telegram.GetAuthorizedClient(ctx, cfg.PhoneNumber)
 	if err != nil {
 		return nil, err
 	}
-	if ok, _ := t.WhoAmI(); !ok.Authorized {
-		return nil, fmt.Errorf("user not logged in %s", user.PhoneNumber)
-	} else {
-		log.Infof("user logged in ", "user", user.PhoneNumber)
-	}
+	log.Infof("user logged in ", "user", cfg.PhoneNumber)
 	return &TelegramSource{
 		c:   t,
 		cfg: cfg,
@@ -77,12 +76,18 @@ func (t *TelegramSource) scrape(src *telegram.Recipient, opts ScrapeOpts) (p []P
 		if m.Date > int(opts.LastFrom.Unix()) {
 			log.Debugf("adding msg as the time criteria is met", "msg time", m.Date, "limit", opts.LastFrom.Unix())
 			t := Post{
-				MediaType: commons.MSG_TYPE,
-				Id:        fmt.Sprintf("%d", m.ID),
-				SourceAc:  fmt.Sprintf("%d", src.UserId),
-				Title:     m.Message,
-				FileName:  telegram.GetFilenameFromMessage(&m),
+				Id:       fmt.Sprintf("%d", m.ID),
+				SrcLink:  telegram.MsgLink(src.UserId, m.ID),
+				Permalink: telegram.MsgLink(src.UserId, m.ID),
+				SourceAc: fmt.Sprintf("%d", src.UserId),
+				Title:    m.Message,
+				Date:     time.Unix(int64(m.Date), 0),
+				Meta: map[string]string{
+					"caption": m.Message,
+					"views":   strconv.Itoa(m.Views),
+				},
 			}
+			t.MediaType, t.FileName, t.Ext = mediaInfo(&m)
 			p = append(p, t)
 		}
 	}
@@ -90,9 +95,49 @@ func (t *TelegramSource) scrape(src *telegram.Recipient, opts ScrapeOpts) (p []P
 	return
 }
 
-func (t *TelegramSource) DownloadItem(ctx context.Context, i *commons.Item) (err error) {
+// DownloadItem fetches the msg again and downloads its media into w, text
+// only msgs are saved as txt files
+func (t *TelegramSource) DownloadItem(ctx context.Context, i *commons.Item, w io.Writer) (err error) {
 	log.Debugf("downloading", "item", i.Id)
-	return
+	id, err := strconv.Atoi(i.Id)
+	if err != nil {
+		return err
+	}
+	msg, err := t.c.GetMessage(ctx, i.SourceAc, id)
+	if err != nil {
+		return err
+	}
+	i.Type, i.FileName, i.Ext = mediaInfo(msg)
+	m, ok := telegram.MediaOf(msg)
+	if !ok {
+		_, err = io.WriteString(w, msg.Message)
+		return err
+	}
+	if err = t.c.DownloadMedia(ctx, m, w); err != nil {
+		return err
+	}
+	log.Debugf("downloaded", "item", i.Id, "file", i.FileName, "size", m.Size)
+	return nil
+}
+
+// mediaInfo returns media type, file name and ext of msg
+func mediaInfo(msg *tg.Message) (typ commons.MediaType, name string, ext string) {
+	m, ok := telegram.MediaOf(msg)
+	if !ok {
+		return commons.MSG_TYPE, fmt.Sprintf("%d.txt", msg.ID), "txt"
+	}
+	name = m.Name
+	ext = strings.TrimPrefix(filepath.Ext(name), ".")
+	mime := telegram.MimeOf(msg)
+	switch {
+	case strings.HasPrefix(mime, "image/"):
+		typ = commons.IMG_TYPE
+	case strings.HasPrefix(mime, "video/"):
+		typ = commons.VID_TYPE
+	default:
+		typ = commons.MSG_TYPE
+	}
+	return typ, name, ext
 }
 
 func (t *TelegramSource) GetClient() *telegram.Telegram {
@@ -0,0 +1,39 @@
+package sources
+
+import (
+	"testing"
+
+	"github.com/gotd/td/tg"
+	"github.com/shivamhw/content-pirate/commons"
+)
+
+func docMsg(id int, mime string, name string) *tg.Message {
+	msg := &tg.Message{ID: id}
+	// flags tell if media is set, a bare field is ignored by GetMedia
+	msg.SetMedia(&tg.MessageMediaDocument{Document: &tg.Document{
+		ID:         int64(id),
+		MimeType:   mime,
+		Attributes: []tg.DocumentAttributeClass{&tg.DocumentAttributeFilename{FileName: name}},
+	}})
+	return msg
+}
+
+func TestMediaInfo(t *testing.T) {
+	cases := []struct {
+		msg  *tg.Message
+		typ  commons.MediaType
+		name string
+		ext  string
+	}{
+		{docMsg(1, "video/mp4", "clip.mp4"), commons.VID_TYPE, "clip.mp4", "mp4"},
+		{docMsg(2, "image/png", "pic.png"), commons.IMG_TYPE, "pic.png", "png"},
+		{docMsg(3, "application/pdf", "doc.pdf"), commons.MSG_TYPE, "doc.pdf", "pdf"},
+		{&tg.Message{ID: 4, Message: "text only"}, commons.MSG_TYPE, "4.txt", "txt"},
+	}
+	for _, c := range cases {
+		typ, name, ext := mediaInfo(c.msg)
+		if typ != c.typ || name != c.name || ext != c.ext {
+			t.Errorf("msg %d: expected %s %s %s, found %s %s %s", c.msg.ID, c.typ, c.name, c.ext, typ, name, ext)
+		}
+	}
+}
@@ -1,17 +1,28 @@
 package store
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"syscall"
+	"text/template"
 
 	"github.com/shivamhw/content-pirate/commons"
 	"github.com/shivamhw/content-pirate/pkg/log"
 )
 
 type FileDstPath struct {
-	BasePath string
-	Clean    bool
+	BasePath   string
+	Clean      bool
+	PathFormat string // text/template of item path under BasePath, SourceAc/FileName if empty
+	Sidecar    bool   // write metadata of every item to <file>.json
+	Index      bool   // append metadata of every item to BasePath/<SourceAc>/index.jsonl
 }
 
 func (f FileDstPath) GetBasePath() string {
@@ -26,8 +37,25 @@ func (f FileDstPath) Type() DstPathType {
 	return FILE_DST_PATH
 }
 
+func (f FileDstPath) NoClean() DstPath {
+	f.Clean = false
+	return f
+}
+
+// files being written are hidden and named after the writing process,
+// .<name>.cp-<pid>-<random>.tmp, so only temp files of processes which are
+// gone are cleaned up
+const tempExt = ".tmp"
+
+var tempRe = regexp.MustCompile(`^\..+\.cp-(\d+)-\d+\.tmp$`)
+
+// cleanedDirs are base paths whose stale temp files this process removed
+var cleanedDirs sync.Map
+
 type FileStore struct {
 	Dst *FileDstPath
+	tpl *template.Template
+	il  sync.Mutex // serializes appends to index files
 }
 
 func NewFileStore(path *FileDstPath) (*FileStore, error) {
@@ -38,7 +66,15 @@ func NewFileStore(path *FileDstPath) (*FileStore, error) {
 	f := &FileStore{
 		Dst: path,
 	}
+	if path.PathFormat != "" {
+		if f.tpl, err = parsePathFormat(path.PathFormat); err != nil {
+			return nil, err
+		}
+	}
 	f.createStructure()
+	if err := f.cleanTemp(); err != nil {
+		log.Warnf("cleaning partial files failed", "path", f.Dst.BasePath, "err", err)
+	}
 	return f, nil
 }
 
@@ -50,22 +86,118 @@ func (f *FileStore) DirExists(path string) bool {
 	return info.IsDir()
 }
 
+// Write copies item to its path atomically and writes its metadata if
+// enabled on the dst path
 func (f *FileStore) Write(i *commons.Item) (string, error) {
-	fullFilePath := fmt.Sprintf("%s/%s", i.Dst, i.FileName)
-	f.CreateDir(filepath.Dir(fullFilePath))
-	outfile, err := os.Create(fullFilePath)
+	fullFilePath, err := f.itemPath(i)
 	if err != nil {
 		return "", err
 	}
-	defer outfile.Close()
-	_, err = outfile.Write(i.Data)
-	return fullFilePath, err
+	if err = f.CreateDir(filepath.Dir(fullFilePath)); err != nil {
+		return "", err
+	}
+	in, err := i.Open()
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	if err = writeAtomic(fullFilePath, in); err != nil {
+		return "", err
+	}
+	return fullFilePath, f.writeMeta(i, fullFilePath)
+}
+
+// writeAtomic copies r to a temp file next to path and renames it in place
+// once synced, so an interrupted write never leaves a truncated file
+func writeAtomic(path string, r io.Reader) (err error) {
+	outfile, err := os.CreateTemp(filepath.Dir(path), fmt.Sprintf(".%s.cp-%d-*%s", filepath.Base(path), os.Getpid(), tempExt))
+	if err != nil {
+		return err
+	}
+	tmp := outfile.Name()
+	defer func() {
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+	// temp files are private, keep mode of files created with os.Create
+	err = outfile.Chmod(0644)
+	if err == nil {
+		_, err = io.Copy(outfile, r)
+	}
+	if err == nil {
+		err = outfile.Sync()
+	}
+	if cerr := outfile.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Link hard links path of item to existing file with same content
+func (f *FileStore) Link(i *commons.Item, existing string) (string, error) {
+	fullFilePath, err := f.itemPath(i)
+	if err != nil {
+		return "", err
+	}
+	if fullFilePath == existing {
+		return fullFilePath, nil
+	}
+	if err := f.CreateDir(filepath.Dir(fullFilePath)); err != nil {
+		return "", err
+	}
+	if err := os.Remove(fullFilePath); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if err := os.Link(existing, fullFilePath); err != nil {
+		return "", err
+	}
+	return fullFilePath, f.writeMeta(i, fullFilePath)
+}
+
+// cleanTemp removes temp files left by writes of processes which died, once
+// per base path in a process
+func (f *FileStore) cleanTemp() error {
+	if _, done := cleanedDirs.LoadOrStore(f.Dst.BasePath, true); done {
+		return nil
+	}
+	return filepath.WalkDir(f.Dst.BasePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		m := tempRe.FindStringSubmatch(d.Name())
+		if d.IsDir() || m == nil {
+			return nil
+		}
+		pid, err := strconv.Atoi(m[1])
+		if err != nil || pid == os.Getpid() || processAlive(pid) {
+			return nil
+		}
+		log.Infof("removing partial file", "path", path)
+		return os.Remove(path)
+	})
+}
+
+// processAlive is false once pid has exited, signal 0 only checks for it
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return !errors.Is(p.Signal(syscall.Signal(0)), os.ErrProcessDone)
 }
 
 func (f *FileStore) CreateDir(path string) (err error) {
 	return os.MkdirAll(path, 0755)
 }
 
+func (f *FileStore) Root() string {
+	return f.Dst.BasePath
+}
+
 func (f *FileStore) ID() (string) {
 	return f.Dst.BasePath
 }
@@ -101,13 +233,33 @@ func (f *FileStore) createStructure() (err error) {
 }
 
 func (f *FileStore) ItemExists(i *commons.Item) bool {
-	path := fmt.Sprintf("%s/%s", f.Dst.BasePath, i.FileName)
+	path, err := f.itemPath(i)
+	if err != nil {
+		return false
+	}
 	if _, err := os.Stat(path); err != nil {
 		return false
 	}
 	return true
 }
 
+func (f *FileStore) PathExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
 func (f *FileStore) GetItemDstPath(i *commons.Item) string {
-	return fmt.Sprintf("%s/%s", f.Dst.BasePath, i.SourceAc)
+	path, err := f.itemPath(i)
+	if err != nil {
+		return fmt.Sprintf("%s/%s", f.Dst.BasePath, sanitizeName(i.SourceAc))
+	}
+	return filepath.Dir(path)
+}
+
+// itemPath is full path of item, rendered from PathFormat if set
+func (f *FileStore) itemPath(i *commons.Item) (string, error) {
+	if f.tpl == nil {
+		return fmt.Sprintf("%s/%s/%s", f.Dst.BasePath, sanitizeName(i.SourceAc), itemFileName(i)), nil
+	}
+	return execPath(f.tpl, f.Dst.BasePath, i)
 }
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingReader returns some content and then fails like a dropped download
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return copy(p, "partial"), errors.New("connection reset")
+}
+
+func tempFiles(t *testing.T, dir string) (names []string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), tempExt) {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+func TestWriteAtomic(t *testing.T) {
+	base := t.TempDir()
+	f, err := NewFileStore(&FileDstPath{BasePath: base})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := testItem(t, "a")
+	path, err := f.Write(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "content of a" {
+		t.Fatalf("unexpected content %q", data)
+	}
+
+	failed := filepath.Join(base, "pics", "b.jpg")
+	if err := writeAtomic(failed, io.MultiReader(strings.NewReader("some"), failingReader{})); err == nil {
+		t.Fatalf("expected error of reader")
+	}
+	if _, err := os.Stat(failed); !os.IsNotExist(err) {
+		t.Fatalf("expected no file after failed write, found %v", err)
+	}
+	if names := tempFiles(t, filepath.Dir(path)); len(names) != 0 {
+		t.Fatalf("expected no temp files, found %v", names)
+	}
+}
+
+func TestCleanTemp(t *testing.T) {
+	// pid of a process which exited
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	dead := cmd.Process.Pid
+
+	base := t.TempDir()
+	dir := filepath.Join(base, "pics")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	stale := fmt.Sprintf(".a.jpg.cp-%d-123%s", dead, tempExt)
+	keep := []string{
+		fmt.Sprintf(".b.jpg.cp-%d-456%s", os.Getpid(), tempExt), // write in flight in this process
+		"notes" + tempExt, // not ours
+	}
+	for _, name := range append(keep, stale) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := NewFileStore(&FileDstPath{BasePath: base}); err != nil {
+		t.Fatal(err)
+	}
+	names := tempFiles(t, dir)
+	if len(names) != len(keep) || strings.Contains(strings.Join(names, " "), stale) {
+		t.Fatalf("expected only %s removed, found %v", stale, names)
+	}
+}
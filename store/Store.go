@@ -1,7 +1,9 @@
 package store
 
 import (
+	"encoding/json"
 	"fmt"
+	"sync"
 
 	"github.com/shivamhw/content-pirate/commons"
 )
@@ -11,6 +13,9 @@ type DstPathType string
 const (
 	FILE_DST_PATH DstPathType = "FILE_DST_PATH"
 	TELEGRAM_DST_PATH DstPathType = "TELEGRAM_DST_PATH"
+	ARCHIVE_DST_PATH DstPathType = "ARCHIVE_DST_PATH"
+	S3_DST_PATH DstPathType = "S3_DST_PATH"
+	WEBDAV_DST_PATH DstPathType = "WEBDAV_DST_PATH"
 )
 
 type DstPath interface {
@@ -19,6 +24,12 @@ type DstPath interface {
 	Type() DstPathType
 }
 
+// DstPathCfg is the serializable form of a DstPath
+type DstPathCfg struct {
+	Type DstPathType
+	Cfg  json.RawMessage
+}
+
 type Store interface {
 	Write(i *commons.Item) (string, error)
 	ItemExists(i *commons.Item) bool
@@ -28,20 +39,131 @@ type Store interface {
 	ID() string
 }
 
+// Linker is implemented by stores which can link an item to content already
+// in the store instead of writing it again
+type Linker interface {
+	Link(i *commons.Item, existing string) (string, error)
+}
+
+// Forwarder is implemented by stores which copy some items from their
+// source link instead of their content, items every store forwards are not
+// downloaded
+type Forwarder interface {
+	Forwards(i *commons.Item) bool
+}
+
+// Discarder is implemented by stores which buffer items, Discard drops what
+// is buffered instead of writing it like Close does
+type Discarder interface {
+	Discard()
+}
+
+// PathChecker is implemented by stores which can tell if content written to
+// path is still there, paths of dedupe indexes are checked with it
+type PathChecker interface {
+	PathExists(path string) bool
+}
+
+// Local is implemented by stores backed by a local dir, indexes of the store
+// are kept in its root
+type Local interface {
+	Root() string
+}
+
+// NoCleaner is implemented by dst paths which can wipe dst on start, a
+// decoded path belongs to a job which already ran so it is never cleaned again
+type NoCleaner interface {
+	NoClean() DstPath
+}
+
+type storeEntry struct {
+	newStore func(DstPath) (Store, error)
+	decode   func([]byte) (DstPath, error)
+}
+
+var (
+	registry = make(map[DstPathType]storeEntry)
+	regL     sync.RWMutex
+)
+
+func init() {
+	Register(TELEGRAM_DST_PATH, func(p *TelegramDstPath) (Store, error) {
+		return NewTelegramStore(p)
+	})
+	Register(FILE_DST_PATH, func(p *FileDstPath) (Store, error) {
+		return NewFileStore(p)
+	})
+	Register(ARCHIVE_DST_PATH, func(p *ArchiveDstPath) (Store, error) {
+		return NewArchiveStore(p)
+	})
+	Register(S3_DST_PATH, func(p *S3DstPath) (Store, error) {
+		return NewS3Store(p)
+	})
+	Register(WEBDAV_DST_PATH, func(p *WebDAVDstPath) (Store, error) {
+		return NewWebDAVStore(p)
+	})
+}
+
+// Register adds a store for dst paths of type P, P.Type() must return typ
+func Register[P DstPath](typ DstPathType, f func(p *P) (Store, error)) {
+	defer regL.Unlock()
+	regL.Lock()
+	registry[typ] = storeEntry{
+		newStore: func(d DstPath) (Store, error) {
+			p, ok := d.(P)
+			if !ok {
+				return nil, fmt.Errorf("dst path %T registered for %s is not %T", d, typ, p)
+			}
+			return f(&p)
+		},
+		decode: func(data []byte) (DstPath, error) {
+			var p P
+			err := json.Unmarshal(data, &p)
+			return p, err
+		},
+	}
+}
+
+func getEntry(typ DstPathType) (storeEntry, error) {
+	defer regL.RUnlock()
+	regL.RLock()
+	e, ok := registry[typ]
+	if !ok {
+		return storeEntry{}, fmt.Errorf("unknown dst store type %s", typ)
+	}
+	return e, nil
+}
+
 func GetStore(d DstPath) (Store, error) {
-	switch p := d.(type) {
-	case TelegramDstPath:
-		if store, err := NewTelegramStore(&p); err != nil {
-			return nil, err
-		} else {
-			return store, nil
-		}
-	case FileDstPath:
-		if store, err := NewFileStore(&p); err != nil {
-			return nil, err
-		} else {
-			return store, nil
-		}
+	e, err := getEntry(d.Type())
+	if err != nil {
+		return nil, err
+	}
+	return e.newStore(d)
+}
+
+func EncodeDstPath(d DstPath) (DstPathCfg, error) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return DstPathCfg{}, err
+	}
+	return DstPathCfg{
+		Type: d.Type(),
+		Cfg:  data,
+	}, nil
+}
+
+func DecodeDstPath(c DstPathCfg) (DstPath, error) {
+	e, err := getEntry(c.Type)
+	if err != nil {
+		return nil, err
+	}
+	p, err := e.decode(c.Cfg)
+	if err != nil {
+		return nil, err
+	}
+	if nc, ok := p.(NoCleaner); ok {
+		p = nc.NoClean()
 	}
-	return nil, fmt.Errorf("unknown dst store type")
+	return p, nil
 }
@@ -0,0 +1,501 @@
+package store
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shivamhw/content-pirate/commons"
+	"github.com/shivamhw/content-pirate/pkg/log"
+)
+
+type ArchiveFormat string
+
+const (
+	ARCHIVE_ZIP   ArchiveFormat = "zip"
+	ARCHIVE_TARGZ ArchiveFormat = "tar.gz"
+)
+
+// manifestName is the entry appended to every part when it is closed
+const manifestName = "manifest.json"
+
+// ArchiveDstPath writes items into BasePath/<Name>-0001.<Format>, a new part
+// is started once MaxItems or MaxBytes (uncompressed) of a part is reached
+type ArchiveDstPath struct {
+	BasePath string
+	Name     string
+	Format   ArchiveFormat
+	MaxItems int
+	MaxBytes int64
+	Clean    bool
+}
+
+func (a ArchiveDstPath) GetBasePath() string {
+	return a.BasePath
+}
+
+func (a ArchiveDstPath) CleanOnStart() bool {
+	return a.Clean
+}
+
+func (a ArchiveDstPath) Type() DstPathType {
+	return ARCHIVE_DST_PATH
+}
+
+func (a ArchiveDstPath) NoClean() DstPath {
+	a.Clean = false
+	return a
+}
+
+func (a *ArchiveDstPath) sanitize() (err error) {
+	if a.BasePath == "" {
+		a.BasePath = "./download"
+	}
+	if a.Name == "" {
+		a.Name = "archive"
+	}
+	if a.Format == "" {
+		a.Format = ARCHIVE_ZIP
+	}
+	if a.Format != ARCHIVE_ZIP && a.Format != ARCHIVE_TARGZ {
+		return fmt.Errorf("unknown archive format %s", a.Format)
+	}
+	a.BasePath, err = filepath.Abs(a.BasePath)
+	return err
+}
+
+func (a *ArchiveDstPath) partPath(n int) string {
+	return filepath.Join(a.BasePath, fmt.Sprintf("%s-%04d.%s", a.Name, n, a.Format))
+}
+
+// parts returns numbers of parts of the archive already on disk
+func (a *ArchiveDstPath) parts() (nums []int) {
+	files, _ := filepath.Glob(filepath.Join(a.BasePath, a.Name+"-*."+string(a.Format)))
+	for _, f := range files {
+		n := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(f), a.Name+"-"), "."+string(a.Format))
+		if v, err := strconv.Atoi(n); err == nil {
+			nums = append(nums, v)
+		}
+	}
+	return nums
+}
+
+// ArchiveStore is a handle on a shared archive, stores of all jobs writing
+// to the same archive share one writer which is finalized when the last
+// store is closed
+type ArchiveStore struct {
+	cfg  *ArchiveDstPath
+	a    *archive
+	once sync.Once
+	l    sync.RWMutex
+	done bool
+}
+
+type ManifestEntry struct {
+	Name     string
+	Id       string
+	SourceAc string
+	Title    string
+	Src      string `json:",omitempty"`
+	Size     int64
+	Hash     string `json:",omitempty"`
+}
+
+type Manifest struct {
+	Part    string
+	Created time.Time
+	Items   []ManifestEntry
+}
+
+var archives = struct {
+	l sync.Mutex
+	m map[string]*archive
+}{
+	m: make(map[string]*archive),
+}
+
+func NewArchiveStore(cfg *ArchiveDstPath) (*ArchiveStore, error) {
+	if err := cfg.sanitize(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(cfg.BasePath, 0755); err != nil {
+		return nil, err
+	}
+	s := &ArchiveStore{cfg: cfg}
+	if cfg.Clean {
+		s.CleanAll(cfg.BasePath)
+	}
+	s.a = acquireArchive(cfg)
+	return s, nil
+}
+
+func acquireArchive(cfg *ArchiveDstPath) *archive {
+	key := cfg.partPath(0)
+	defer archives.l.Unlock()
+	archives.l.Lock()
+	a, ok := archives.m[key]
+	if !ok {
+		a = openArchive(*cfg)
+		archives.m[key] = a
+	}
+	a.refs++
+	return a
+}
+
+func (s *ArchiveStore) Write(i *commons.Item) (string, error) {
+	s.l.RLock()
+	defer s.l.RUnlock()
+	if s.done {
+		return "", fmt.Errorf("archive store %s is closed", s.ID())
+	}
+	return s.a.add(i, entryName(i))
+}
+
+func (s *ArchiveStore) ItemExists(i *commons.Item) bool {
+	return s.a.has(entryName(i))
+}
+
+func (s *ArchiveStore) GetItemDstPath(i *commons.Item) string {
+	return s.cfg.BasePath
+}
+
+func (s *ArchiveStore) CreateDir(d string) error {
+	return os.MkdirAll(d, 0755)
+}
+
+// CleanAll removes parts of this archive, other files in d are kept
+func (s *ArchiveStore) CleanAll(d string) error {
+	for _, n := range s.cfg.parts() {
+		if err := os.Remove(s.cfg.partPath(n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ArchiveStore) ID() string {
+	return filepath.Join(s.cfg.BasePath, s.cfg.Name+"."+string(s.cfg.Format))
+}
+
+// Close releases the archive, last close of an archive appends manifest to
+// the open part and closes it
+func (s *ArchiveStore) Close() (err error) {
+	s.once.Do(func() {
+		s.l.Lock()
+		s.done = true
+		s.l.Unlock()
+		err = releaseArchive(s.cfg, s.a)
+	})
+	return err
+}
+
+func releaseArchive(cfg *ArchiveDstPath, a *archive) error {
+	archives.l.Lock()
+	a.refs--
+	last := a.refs == 0
+	if last {
+		delete(archives.m, cfg.partPath(0))
+	}
+	archives.l.Unlock()
+	if !last {
+		return nil
+	}
+	return a.finalize()
+}
+
+func entryName(i *commons.Item) string {
+	return path.Join(sanitizeName(i.SourceAc), sanitizeName(itemFileName(i)))
+}
+
+// archive is the writer of parts of one ArchiveDstPath
+type archive struct {
+	l        sync.Mutex
+	cfg      ArchiveDstPath
+	refs     int
+	next     int
+	f        *os.File
+	w        partWriter
+	part     string
+	items    int
+	bytes    int64
+	index    map[string]bool
+	manifest []ManifestEntry
+}
+
+type partWriter interface {
+	add(name string, size int64, r io.Reader) error
+	close() error
+}
+
+// openArchive indexes parts already on disk, new items go to a new part
+func openArchive(cfg ArchiveDstPath) *archive {
+	a := &archive{
+		cfg:   cfg,
+		next:  1,
+		index: make(map[string]bool),
+	}
+	for _, n := range cfg.parts() {
+		a.next = max(a.next, n+1)
+		names, err := readPart(cfg.Format, cfg.partPath(n))
+		if err != nil {
+			log.Warnf("reading archive part failed", "part", cfg.partPath(n), "err", err)
+		}
+		for _, name := range names {
+			a.index[name] = true
+		}
+	}
+	return a
+}
+
+func (a *archive) has(name string) bool {
+	defer a.l.Unlock()
+	a.l.Lock()
+	return a.index[name]
+}
+
+func (a *archive) add(i *commons.Item, name string) (string, error) {
+	defer a.l.Unlock()
+	a.l.Lock()
+	if a.index[name] {
+		return a.dst(name), nil
+	}
+	r, err := os.Open(i.Path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	info, err := r.Stat()
+	if err != nil {
+		return "", err
+	}
+	if a.f != nil && a.full(info.Size()) {
+		if err := a.closePart(); err != nil {
+			return "", err
+		}
+	}
+	if a.f == nil {
+		if err := a.openPart(); err != nil {
+			return "", err
+		}
+	}
+	if err := a.w.add(name, info.Size(), r); err != nil {
+		// part holds a cut short entry now, it is closed with a manifest
+		// without the item and later items go to a new part
+		if cerr := a.closePart(); cerr != nil {
+			log.Errorf("closing archive part failed", "part", a.part, "err", cerr)
+		}
+		return "", err
+	}
+	a.items++
+	a.bytes += info.Size()
+	a.index[name] = true
+	a.manifest = append(a.manifest, ManifestEntry{
+		Name:     name,
+		Id:       i.Id,
+		SourceAc: i.SourceAc,
+		Title:    i.Title,
+		Src:      i.Src,
+		Size:     info.Size(),
+		Hash:     i.Hash,
+	})
+	return a.dst(name), nil
+}
+
+func (a *archive) dst(name string) string {
+	return a.part + "/" + name
+}
+
+func (a *archive) full(size int64) bool {
+	if a.cfg.MaxItems > 0 && a.items >= a.cfg.MaxItems {
+		return true
+	}
+	return a.cfg.MaxBytes > 0 && a.bytes+size > a.cfg.MaxBytes
+}
+
+func (a *archive) openPart() (err error) {
+	a.part = a.cfg.partPath(a.next)
+	a.next++
+	a.f, err = os.Create(a.part)
+	if err != nil {
+		a.f = nil
+		return err
+	}
+	switch a.cfg.Format {
+	case ARCHIVE_TARGZ:
+		gz := gzip.NewWriter(a.f)
+		a.w = &tarPart{gz: gz, t: tar.NewWriter(gz)}
+	default:
+		a.w = &zipPart{z: zip.NewWriter(a.f)}
+	}
+	log.Infof("started archive part", "part", a.part)
+	return nil
+}
+
+// closePart appends manifest and closes the open part, a.l must be held
+func (a *archive) closePart() error {
+	if a.f == nil {
+		return nil
+	}
+	data, err := json.MarshalIndent(Manifest{
+		Part:    filepath.Base(a.part),
+		Created: time.Now().UTC(),
+		Items:   a.manifest,
+	}, "", "  ")
+	if err == nil {
+		err = a.w.add(manifestName, int64(len(data)), strings.NewReader(string(data)))
+	}
+	if cerr := a.w.close(); err == nil {
+		err = cerr
+	}
+	if serr := a.f.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := a.f.Close(); err == nil {
+		err = cerr
+	}
+	log.Infof("closed archive part", "part", a.part, "items", a.items, "bytes", a.bytes)
+	a.f, a.w = nil, nil
+	a.items, a.bytes, a.manifest = 0, 0, nil
+	return err
+}
+
+func (a *archive) finalize() error {
+	defer a.l.Unlock()
+	a.l.Lock()
+	return a.closePart()
+}
+
+type zipPart struct {
+	z *zip.Writer
+}
+
+func (p *zipPart) add(name string, _ int64, r io.Reader) error {
+	w, err := p.z.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (p *zipPart) close() error {
+	return p.z.Close()
+}
+
+type tarPart struct {
+	gz *gzip.Writer
+	t  *tar.Writer
+}
+
+func (p *tarPart) add(name string, size int64, r io.Reader) error {
+	err := p.t.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(p.t, r)
+	if err != nil && n < size {
+		// pad the entry to its size so the tar stays readable
+		if _, perr := io.CopyN(p.t, zeros{}, size-n); perr != nil {
+			log.Warnf("padding archive entry failed", "entry", name, "err", perr)
+		}
+	}
+	return err
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func (p *tarPart) close() error {
+	if err := p.t.Close(); err != nil {
+		return err
+	}
+	return p.gz.Close()
+}
+
+// readPart lists items of a part, from its manifest if the part was closed
+// as entries which failed midway are left out of it. Entries before a
+// corrupt tail are returned with the error.
+func readPart(format ArchiveFormat, file string) (names []string, err error) {
+	if format == ARCHIVE_ZIP {
+		r, err := zip.OpenReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			if f.Name != manifestName {
+				names = append(names, f.Name)
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return names, err
+			}
+			m, err := readManifest(rc)
+			rc.Close()
+			if err != nil {
+				return names, err
+			}
+			return m, nil
+		}
+		return names, nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	t := tar.NewReader(gz)
+	for {
+		h, err := t.Next()
+		if errors.Is(err, io.EOF) {
+			return names, nil
+		}
+		if err != nil {
+			return names, err
+		}
+		if h.Name == manifestName {
+			return readManifest(t)
+		}
+		names = append(names, h.Name)
+	}
+}
+
+func readManifest(r io.Reader) (names []string, err error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("reading manifest failed %w", err)
+	}
+	for _, e := range m.Items {
+		names = append(names, e.Name)
+	}
+	return names, nil
+}
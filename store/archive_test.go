@@ -0,0 +1,108 @@
+package store
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/shivamhw/content-pirate/commons"
+)
+
+func testItem(t *testing.T, id string) *commons.Item {
+	p := filepath.Join(t.TempDir(), id)
+	if err := os.WriteFile(p, []byte("content of "+id), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &commons.Item{Id: id, SourceAc: "pics", Ext: "jpg", Path: p}
+}
+
+func TestArchiveRollover(t *testing.T) {
+	for _, format := range []ArchiveFormat{ARCHIVE_ZIP, ARCHIVE_TARGZ} {
+		base := t.TempDir()
+		cfg := &ArchiveDstPath{BasePath: base, Format: format, MaxItems: 2}
+		s, err := NewArchiveStore(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		for n := range 5 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := s.Write(testItem(t, fmt.Sprintf("%d", n))); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if parts := cfg.parts(); len(parts) != 3 {
+			t.Fatalf("%s: expected 3 parts, found %v", format, parts)
+		}
+		names, err := readPart(format, cfg.partPath(3))
+		if err != nil || len(names) != 1 {
+			t.Fatalf("%s: expected 1 item in last part, found %v %v", format, names, err)
+		}
+
+		// a new store indexes parts on disk
+		s, err = NewArchiveStore(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !s.ItemExists(testItem(t, "4")) || s.ItemExists(testItem(t, "9")) {
+			t.Fatalf("%s: ItemExists does not match archive index", format)
+		}
+		s.Close()
+	}
+}
+
+func TestArchiveManifest(t *testing.T) {
+	cfg := &ArchiveDstPath{BasePath: t.TempDir()}
+	s, err := NewArchiveStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write(testItem(t, "a"))
+	s.Close()
+	r, err := zip.OpenReader(cfg.partPath(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if len(r.File) != 2 || r.File[1].Name != manifestName {
+		t.Fatalf("expected item and manifest in part, found %d files", len(r.File))
+	}
+}
+
+func TestArchiveFailedEntry(t *testing.T) {
+	for _, format := range []ArchiveFormat{ARCHIVE_ZIP, ARCHIVE_TARGZ} {
+		cfg := &ArchiveDstPath{BasePath: t.TempDir(), Format: format}
+		s, err := NewArchiveStore(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Write(testItem(t, "a")); err != nil {
+			t.Fatal(err)
+		}
+		// reading a dir fails after the entry is started
+		broken := &commons.Item{Id: "b", SourceAc: "pics", Ext: "jpg", Path: t.TempDir()}
+		if _, err := s.Write(broken); err == nil {
+			t.Fatalf("%s: expected error writing unreadable item", format)
+		}
+		if _, err := s.Write(testItem(t, "c")); err != nil {
+			t.Fatalf("%s: write after failed entry failed %s", format, err)
+		}
+		s.Close()
+		for n, want := range []string{"pics/a.jpg", "pics/c.jpg"} {
+			names, err := readPart(format, cfg.partPath(n+1))
+			if err != nil || len(names) != 1 || names[0] != want {
+				t.Fatalf("%s: expected %s in part %d, found %v %v", format, want, n+1, names, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/shivamhw/content-pirate/commons"
+)
+
+// indexFile is the per source index of a file store
+const indexFile = "index.jsonl"
+
+// ItemMeta is what a file store records about a saved item in sidecars and
+// index files
+type ItemMeta struct {
+	Id        string
+	SourceAc  string
+	Title     string
+	Author    string `json:",omitempty"`
+	Date      time.Time
+	Score     int    `json:",omitempty"`
+	Permalink string `json:",omitempty"`
+	Src       string `json:",omitempty"`
+	Type      commons.MediaType
+	FileName  string
+	Path      string
+	Size      int64
+	Hash      string            `json:",omitempty"`
+	GroupId   string            `json:",omitempty"`
+	GroupIdx  int               `json:",omitempty"`
+	Meta      map[string]string `json:",omitempty"`
+	SavedAt   time.Time
+}
+
+func newItemMeta(i *commons.Item, path string) ItemMeta {
+	return ItemMeta{
+		Id:        i.Id,
+		SourceAc:  i.SourceAc,
+		Title:     i.Title,
+		Author:    i.Author,
+		Date:      i.Date,
+		Score:     i.Score,
+		Permalink: i.Permalink,
+		Src:       i.Src,
+		Type:      i.Type,
+		FileName:  filepath.Base(path),
+		Path:      path,
+		Size:      i.Size,
+		Hash:      i.Hash,
+		GroupId:   i.GroupId,
+		GroupIdx:  i.GroupIdx,
+		Meta:      i.Meta,
+		SavedAt:   time.Now().UTC(),
+	}
+}
+
+// writeMeta writes sidecar and index entry of item saved at path
+func (f *FileStore) writeMeta(i *commons.Item, path string) error {
+	if !f.Dst.Sidecar && !f.Dst.Index {
+		return nil
+	}
+	m := newItemMeta(i, path)
+	if f.Dst.Sidecar {
+		data, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err = writeAtomic(path+".json", bytes.NewReader(data)); err != nil {
+			return err
+		}
+	}
+	if f.Dst.Index {
+		return f.appendIndex(m)
+	}
+	return nil
+}
+
+func (f *FileStore) appendIndex(m ItemMeta) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(f.Dst.BasePath, sanitizeName(m.SourceAc))
+	if err = f.CreateDir(dir); err != nil {
+		return err
+	}
+	defer f.il.Unlock()
+	f.il.Lock()
+	file, err := os.OpenFile(filepath.Join(dir, indexFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
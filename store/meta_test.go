@@ -0,0 +1,57 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shivamhw/content-pirate/commons"
+)
+
+func TestSidecarAndIndex(t *testing.T) {
+	base := t.TempDir()
+	f, err := NewFileStore(&FileDstPath{BasePath: base, Sidecar: true, Index: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := filepath.Join(t.TempDir(), "content")
+	if err := os.WriteFile(content, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b"} {
+		i := &commons.Item{Id: id, SourceAc: "pics", Title: "title " + id, Type: commons.IMG_TYPE, Ext: "jpg", Size: 4, Path: content}
+		path, err := f.Write(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path + ".json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m ItemMeta
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Fatal(err)
+		}
+		if m.Id != id || m.Title != i.Title || m.Path != path || m.Size != 4 {
+			t.Fatalf("unexpected sidecar of %s %+v", id, m)
+		}
+	}
+
+	file, err := os.Open(filepath.Join(base, "pics", indexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	lines := 0
+	for sc := bufio.NewScanner(file); sc.Scan(); lines++ {
+		var m ItemMeta
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lines != 2 {
+		t.Fatalf("expected 2 index entries, found %d", lines)
+	}
+}
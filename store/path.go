@@ -0,0 +1,108 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/flytam/filenamify"
+	"github.com/iyear/tdl/pkg/tplfunc"
+	"github.com/shivamhw/content-pirate/commons"
+)
+
+// maxNameLen keeps names of long titles well under the 255 bytes most file
+// systems allow
+const maxNameLen = 100
+
+// PathData are the fields available to PathFormat of a FileDstPath, string
+// fields are sanitized to be safe as file names
+type PathData struct {
+	SourceAc  string
+	Title     string
+	Id        string
+	Author    string
+	Date      time.Time
+	MediaType string
+	Ext       string
+	Score     int
+	FileName  string
+	GroupId   string
+	Index     int // position of item in its gallery, 0 for single posts
+}
+
+func newPathData(i *commons.Item) PathData {
+	return PathData{
+		SourceAc:  sanitizeName(i.SourceAc),
+		Title:     sanitizeName(i.Title),
+		Id:        sanitizeName(i.Id),
+		Author:    sanitizeName(i.Author),
+		Date:      i.Date,
+		MediaType: sanitizeName(i.Type),
+		Ext:       sanitizeName(i.Ext),
+		Score:     i.Score,
+		FileName:  sanitizeName(itemFileName(i)),
+		GroupId:   sanitizeName(i.GroupId),
+		Index:     i.GroupIdx,
+	}
+}
+
+func parsePathFormat(format string) (*template.Template, error) {
+	tpl, err := template.New("path").
+		Funcs(tplfunc.FuncMap(tplfunc.All...)).
+		Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("parsing path format %q failed %w", format, err)
+	}
+	return tpl, nil
+}
+
+// execPath renders path of item relative to base, rendered paths can't
+// leave base
+func execPath(tpl *template.Template, base string, i *commons.Item) (string, error) {
+	rel, err := renderPath(tpl, i)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, rel), nil
+}
+
+// renderPath renders tpl for item into a clean relative path
+func renderPath(tpl *template.Template, i *commons.Item) (string, error) {
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, newPathData(i)); err != nil {
+		return "", err
+	}
+	rel := filepath.Clean(strings.TrimSpace(buf.String()))
+	if rel == "." || filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path format rendered invalid path %q for item %s", buf.String(), i.Id)
+	}
+	return rel, nil
+}
+
+// itemFileName is file name of item, id and ext if source didn't name it
+func itemFileName(i *commons.Item) string {
+	if i.FileName != "" {
+		return i.FileName
+	}
+	if i.Ext == "" {
+		return i.Id
+	}
+	return i.Id + "." + i.Ext
+}
+
+func sanitizeName(s string) string {
+	if s == "" {
+		return ""
+	}
+	res, err := filenamify.FilenamifyV2(s, func(o *filenamify.Options) {
+		o.Replacement = "_"
+		o.MaxLength = maxNameLen
+	})
+	if err != nil {
+		return "_"
+	}
+	return strings.TrimSpace(strings.ReplaceAll(res, "\n", " "))
+}
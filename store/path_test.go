@@ -0,0 +1,57 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shivamhw/content-pirate/commons"
+)
+
+func TestPathFormat(t *testing.T) {
+	base := t.TempDir()
+	f, err := NewFileStore(&FileDstPath{
+		BasePath:   base,
+		PathFormat: `{{.SourceAc}}/{{.Date.Format "2006-01"}}/{{.Author}}_{{.Title}}_{{.Index}}.{{.Ext}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := &commons.Item{
+		Id:       "abc",
+		SourceAc: "pics",
+		Title:    "cats/dogs: a <story>",
+		Author:   "someone",
+		Date:     time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		Ext:      "jpg",
+		GroupIdx: 2,
+	}
+	path, err := f.itemPath(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(base, "pics", "2024-03", "someone_cats_dogs_ a _story_2.jpg")
+	if path != want {
+		t.Fatalf("expected %s, found %s", want, path)
+	}
+
+	f.tpl, _ = parsePathFormat(`../{{.Id}}`)
+	if _, err := f.itemPath(i); err == nil {
+		t.Fatalf("expected error for path outside base")
+	}
+}
+
+func TestDefaultPathSanitizesSource(t *testing.T) {
+	base := t.TempDir()
+	f, err := NewFileStore(&FileDstPath{BasePath: base})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := f.itemPath(&commons.Item{Id: "abc", SourceAc: "u/someone/saved", Ext: "jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(base, "u_someone_saved", "abc.jpg"); path != want {
+		t.Fatalf("expected %s, found %s", want, path)
+	}
+}
@@ -0,0 +1,374 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/shivamhw/content-pirate/commons"
+	"github.com/shivamhw/content-pirate/pkg/log"
+)
+
+const (
+	defaultPartSize  = 8 << 20
+	defaultKeyFormat = "{{.SourceAc}}/{{.FileName}}"
+)
+
+// S3DstPath uploads items to a bucket of an s3 compatible service, keys are
+// addressed path style so MinIO works without dns setup. Keys default to
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+type S3DstPath struct {
+	Endpoint    string // e.g. https://s3.us-east-1.amazonaws.com or http://localhost:9000
+	Region      string
+	Bucket      string
+	AccessKey   string
+	SecretKey   string `json:"-"`
+	KeyFormat   string // text/template of object key, same fields as PathFormat of FileDstPath
+	ContentType string // content type of every object, detected from ext if empty
+	PartSize    int64  // items larger than this are uploaded in parts
+}
+
+func (s S3DstPath) GetBasePath() string {
+	return fmt.Sprintf("s3://%s", s.Bucket)
+}
+
+func (s S3DstPath) CleanOnStart() bool {
+	return false
+}
+
+func (s S3DstPath) Type() DstPathType {
+	return S3_DST_PATH
+}
+
+func (s *S3DstPath) sanitize() error {
+	if s.Endpoint == "" || s.Bucket == "" {
+		return fmt.Errorf("endpoint and bucket are required for s3 dst")
+	}
+	s.Endpoint = strings.TrimSuffix(s.Endpoint, "/")
+	if s.Region == "" {
+		s.Region = "us-east-1"
+	}
+	if s.AccessKey == "" {
+		s.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if s.SecretKey == "" {
+		s.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if s.KeyFormat == "" {
+		s.KeyFormat = defaultKeyFormat
+	}
+	if s.PartSize <= 0 {
+		s.PartSize = defaultPartSize
+	}
+	return nil
+}
+
+type S3Store struct {
+	cfg *S3DstPath
+	tpl *template.Template
+	c   *http.Client
+}
+
+func NewS3Store(cfg *S3DstPath) (*S3Store, error) {
+	if err := cfg.sanitize(); err != nil {
+		return nil, err
+	}
+	tpl, err := parsePathFormat(cfg.KeyFormat)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Store{
+		cfg: cfg,
+		tpl: tpl,
+		c:   &http.Client{Timeout: 10 * time.Minute},
+	}, nil
+}
+
+func (s *S3Store) key(i *commons.Item) (string, error) {
+	rel, err := renderPath(s.tpl, i)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func (s *S3Store) contentType(i *commons.Item) string {
+	if s.cfg.ContentType != "" {
+		return s.cfg.ContentType
+	}
+	if t := mime.TypeByExtension("." + i.Ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// Write uploads item in one put or in parts of PartSize, only one part is
+// held in memory
+func (s *S3Store) Write(i *commons.Item) (string, error) {
+	key, err := s.key(i)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(i.Path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	ctx := itemCtx(i)
+	if info.Size() <= s.cfg.PartSize {
+		body, err := io.ReadAll(f)
+		if err != nil {
+			return "", err
+		}
+		resp, err := s.do(ctx, http.MethodPut, key, nil, body, s.contentType(i))
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+	} else if err = s.multipart(ctx, key, f, s.contentType(i)); err != nil {
+		return "", err
+	}
+	log.Debugf("uploaded object", "bucket", s.cfg.Bucket, "key", key, "size", info.Size())
+	return fmt.Sprintf("s3://%s/%s", s.cfg.Bucket, key), nil
+}
+
+type initiateResult struct {
+	UploadId string `xml:"UploadId"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+func (s *S3Store) multipart(ctx context.Context, key string, r io.Reader, contentType string) (err error) {
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, contentType)
+	if err != nil {
+		return err
+	}
+	var init initiateResult
+	err = xml.NewDecoder(resp.Body).Decode(&init)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("starting multipart upload of %s failed %w", key, err)
+	}
+	id := url.Values{"uploadId": {init.UploadId}}
+	defer func() {
+		if err == nil {
+			return
+		}
+		// parts of a failed upload are billed until aborted
+		if resp, aErr := s.do(context.Background(), http.MethodDelete, key, id, nil, ""); aErr == nil {
+			resp.Body.Close()
+		}
+	}()
+	var done completeUpload
+	buf := make([]byte, s.cfg.PartSize)
+	for n := 1; ; n++ {
+		size, rErr := io.ReadFull(r, buf)
+		if rErr == io.EOF {
+			break
+		}
+		if rErr != nil && rErr != io.ErrUnexpectedEOF {
+			return rErr
+		}
+		q := url.Values{"partNumber": {fmt.Sprint(n)}, "uploadId": {init.UploadId}}
+		resp, err := s.do(ctx, http.MethodPut, key, q, buf[:size], "")
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		done.Parts = append(done.Parts, completedPart{PartNumber: n, ETag: resp.Header.Get("ETag")})
+		if rErr == io.ErrUnexpectedEOF {
+			break
+		}
+	}
+	body, err := xml.Marshal(done)
+	if err != nil {
+		return err
+	}
+	resp, err = s.do(ctx, http.MethodPost, key, id, body, "application/xml")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Store) ItemExists(i *commons.Item) bool {
+	key, err := s.key(i)
+	if err != nil {
+		return false
+	}
+	return s.keyExists(key)
+}
+
+// PathExists checks an s3://<bucket>/<key> path returned by Write
+func (s *S3Store) PathExists(p string) bool {
+	key, ok := strings.CutPrefix(p, fmt.Sprintf("s3://%s/", s.cfg.Bucket))
+	return ok && s.keyExists(key)
+}
+
+func (s *S3Store) keyExists(key string) bool {
+	resp, err := s.do(context.Background(), http.MethodHead, key, nil, nil, "")
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return true
+}
+
+func (s *S3Store) GetItemDstPath(i *commons.Item) string {
+	return s.cfg.GetBasePath()
+}
+
+func (s *S3Store) CreateDir(d string) error {
+	return nil
+}
+
+func (s *S3Store) CleanAll(d string) error {
+	return nil
+}
+
+func (s *S3Store) ID() string {
+	return fmt.Sprintf("%s/%s", s.cfg.Endpoint, s.cfg.Bucket)
+}
+
+// do sends a signed request for key, non 2xx responses are errors
+func (s *S3Store) do(ctx context.Context, method, key string, q url.Values, body []byte, contentType string) (*http.Response, error) {
+	u, err := url.Parse(s.cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/" + s.cfg.Bucket + "/" + key
+	u.RawPath = "/" + awsEscape(s.cfg.Bucket) + "/" + awsEscape(key)
+	u.RawQuery = canonicalQuery(q)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, body, time.Now().UTC())
+	resp, err := s.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s returned %d: %s", method, key, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// sign adds aws signature v4 headers to req
+func (s *S3Store) sign(req *http.Request, body []byte, now time.Time) {
+	sum := sha256.Sum256(body)
+	payload := hex.EncodeToString(sum[:])
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if req.Header.Get("Content-Type") != "" {
+		signed = append(signed, "content-type")
+	}
+	sort.Strings(signed)
+	var headers strings.Builder
+	for _, h := range signed {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+		fmt.Fprintf(&headers, "%s:%s\n", h, strings.TrimSpace(v))
+	}
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers.String(),
+		strings.Join(signed, ";"),
+		payload,
+	}, "\n")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s.cfg.Region)
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := fmt.Sprintf("AWS4-HMAC-SHA256\n%s\n%s\n%s", amzDate, scope, hex.EncodeToString(hash[:]))
+	key := hmacSha256([]byte("AWS4"+s.cfg.SecretKey), date)
+	key = hmacSha256(key, s.cfg.Region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSha256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, strings.Join(signed, ";"), sig))
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsEscape percent encodes everything but unreserved chars and slashes, as
+// the canonical request of signature v4 expects
+func awsEscape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, awsEscape(k)+"="+strings.ReplaceAll(awsEscape(v), "/", "%2F"))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// itemCtx is the context of item, background for items built outside the
+// scrapper
+func itemCtx(i *commons.Item) context.Context {
+	if i.Ctx != nil {
+		return i.Ctx
+	}
+	return context.Background()
+}
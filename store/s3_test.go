@@ -0,0 +1,116 @@
+package store
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shivamhw/content-pirate/commons"
+)
+
+// fakeS3 keeps objects in memory and understands the requests S3Store sends
+type fakeS3 struct {
+	l       sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+	parts   map[string]map[int][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.l.Lock()
+	defer f.l.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	key := r.URL.Path
+	q := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodHead:
+		if _, ok := f.objects[key]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		f.parts[key] = make(map[int][]byte)
+		f.types[key] = r.Header.Get("Content-Type")
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", "up1")
+	case r.Method == http.MethodPut && q.Has("partNumber"):
+		var n int
+		fmt.Sscan(q.Get("partNumber"), &n)
+		f.parts[key][n] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"etag%d"`, n))
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		var done completeUpload
+		if err := xml.Unmarshal(body, &done); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var obj []byte
+		for _, p := range done.Parts {
+			obj = append(obj, f.parts[key][p.PartNumber]...)
+		}
+		f.objects[key] = obj
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+		f.types[key] = r.Header.Get("Content-Type")
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}, types: map[string]string{}, parts: map[string]map[int][]byte{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	s, err := NewS3Store(&S3DstPath{
+		Endpoint:  srv.URL,
+		Bucket:    "media",
+		AccessKey: "key",
+		SecretKey: "secret",
+		KeyFormat: "{{.SourceAc}}/{{.Id}} {{.Index}}.{{.Ext}}",
+		PartSize:  10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	small := testItem(t, "a")
+	if s.ItemExists(small) {
+		t.Fatalf("item exists before write")
+	}
+	dst, err := s.Write(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst != "s3://media/pics/a 0.jpg" || !s.ItemExists(small) {
+		t.Fatalf("unexpected dst %s or missing object", dst)
+	}
+	if ct := fake.types["/media/pics/a 0.jpg"]; ct != "image/jpeg" {
+		t.Fatalf("expected image/jpeg content type, found %s", ct)
+	}
+
+	// 25 bytes in parts of 10
+	content := []byte("0123456789abcdefghijklmno")
+	big := &commons.Item{Id: "b", SourceAc: "pics", Ext: "mp4", Path: filepath.Join(t.TempDir(), "b")}
+	if err := os.WriteFile(big.Path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Write(big); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.objects["/media/pics/b 0.mp4"]; !bytes.Equal(got, content) {
+		t.Fatalf("multipart upload assembled %q", got)
+	}
+	if n := len(fake.parts["/media/pics/b 0.mp4"]); n != 3 {
+		t.Fatalf("expected 3 parts, found %d", n)
+	}
+}
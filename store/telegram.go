@@ -1,16 +1,42 @@
 package store
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
 
+	"github.com/gotd/td/tg"
 	"github.com/shivamhw/content-pirate/commons"
 	"github.com/shivamhw/content-pirate/pkg/log"
 	"github.com/shivamhw/content-pirate/pkg/telegram"
 )
 
 type TelegramStore struct {
-	cfg *TelegramDstPath
-	C   *telegram.Telegram
+	cfg    *TelegramDstPath
+	C      *telegram.Telegram
+	up     albumSender
+	l      sync.Mutex
+	albums map[string]*album
+	// discarded is set once pending albums are dropped, later album items
+	// are dropped too
+	discarded bool
+}
+
+// albumSender uploads and sends albums, it is the telegram client outside
+// of tests
+type albumSender interface {
+	UploadAlbumItem(to string, m telegram.Media) (telegram.UploadedMedia, error)
+	SendAlbum(to string, caption string, media []telegram.UploadedMedia) ([]*tg.Message, error)
+}
+
+type album struct {
+	caption string
+	size    int
+	media   map[int]telegram.UploadedMedia
 }
 
 type TelegramDstPath struct {
@@ -19,8 +45,18 @@ type TelegramDstPath struct {
 }
 
 func NewTelegramStore(cfg *TelegramDstPath) (*TelegramStore, error) {
+	if cfg.PhoneNumber == "" {
+		return nil, fmt.Errorf("phone number is required for telegram dst %d", cfg.ChatId)
+	}
+	c, err := telegram.GetAuthorizedClient(context.Background(), cfg.PhoneNumber)
+	if err != nil {
+		return nil, err
+	}
 	return &TelegramStore{
-		cfg: cfg,
+		cfg:    cfg,
+		C:      c,
+		up:     c,
+		albums: make(map[string]*album),
 	}, nil
 }
 
@@ -44,13 +80,137 @@ func (s *TelegramStore) GetItemDstPath(i *commons.Item) string {
 	return fmt.Sprintf("%d", s.cfg.ChatId)
 }
 
+// Forwards reports if item is forwarded from its source msg, text msgs and
+// msgs of other chats are never uploaded again
+func (s *TelegramStore) Forwards(i *commons.Item) bool {
+	return i.Type == commons.MSG_TYPE || telegram.IsMsgLink(i.Src)
+}
+
 func (s *TelegramStore) Write(i *commons.Item) (path string, err error) {
-	_, err = s.C.ForwardMsg(i.SourceAc, i.Dst, i.Id)
-	if err != nil {
+	if s.Forwards(i) {
+		_, err = s.C.ForwardMsg(i.SourceAc, i.Dst, i.Id)
+		if err != nil {
+			return "", err
+		}
+		log.Infof("forwarded msg", "from", i.SourceAc, "to", i.Dst, "msg", i.FileName)
+		return i.Dst, err
+	}
+	if i.Path == "" {
+		return "", fmt.Errorf("no data to upload for item %s", i.Id)
+	}
+	m := toMedia(i)
+	if i.GroupSize > 1 {
+		return s.ID(), s.addToAlbum(i, m)
+	}
+	if _, err = s.C.SendMedia(s.ID(), i.Title, m); err != nil {
 		return "", err
 	}
-	log.Infof("forwarded msg", "from", i.SourceAc, "to", i.Dst, "msg", i.FileName)
-	return i.Dst, err
+	log.Infof("uploaded media", "to", s.ID(), "file", m.Name)
+	return s.ID(), nil
+}
+
+// addToAlbum uploads gallery items as they come and buffers the uploaded
+// refs without waiting for the rest of the gallery, so an album never holds
+// more workers than it has items in flight. The write which completes the
+// album sends it and returns the send result, a failed album is kept so the
+// retry of that write sends it again. Albums missing items are sent by Close.
+func (s *TelegramStore) addToAlbum(i *commons.Item, m telegram.Media) error {
+	in, err := s.up.UploadAlbumItem(s.ID(), m)
+	if err != nil {
+		return err
+	}
+	key := i.SourceAc + "/" + i.GroupId
+	s.l.Lock()
+	if s.discarded {
+		s.l.Unlock()
+		return fmt.Errorf("albums of %s are discarded, dropping item %s", s.ID(), i.Id)
+	}
+	a, ok := s.albums[key]
+	if !ok {
+		a = &album{
+			caption: i.Title,
+			size:    i.GroupSize,
+			media:   make(map[int]telegram.UploadedMedia),
+		}
+		s.albums[key] = a
+	}
+	a.media[i.GroupIdx] = in
+	full := len(a.media) >= a.size
+	if full {
+		delete(s.albums, key)
+	}
+	s.l.Unlock()
+	if !full {
+		log.Debugf("buffered album item", "album", key, "item", i.Id)
+		return nil
+	}
+	if err = s.sendAlbum(key, a); err != nil {
+		s.l.Lock()
+		if _, ok := s.albums[key]; !ok {
+			s.albums[key] = a
+		}
+		s.l.Unlock()
+	}
+	return err
+}
+
+func (s *TelegramStore) sendAlbum(key string, a *album) error {
+	// keep gallery order irrespective of which item finished first
+	idxs := slices.Sorted(maps.Keys(a.media))
+	media := make([]telegram.UploadedMedia, 0, len(idxs))
+	for _, n := range idxs {
+		media = append(media, a.media[n])
+	}
+	if _, err := s.up.SendAlbum(s.ID(), a.caption, media); err != nil {
+		log.Errorf("sending album failed", "to", s.ID(), "album", key, "err", err)
+		return err
+	}
+	log.Infof("uploaded album", "to", s.ID(), "album", key, "items", len(a.media))
+	return nil
+}
+
+// takeAlbums removes and returns albums still waiting for items
+func (s *TelegramStore) takeAlbums() map[string]*album {
+	defer s.l.Unlock()
+	s.l.Lock()
+	albums := s.albums
+	s.albums = make(map[string]*album)
+	return albums
+}
+
+// Discard drops albums still waiting for items, for cancelled jobs
+func (s *TelegramStore) Discard() {
+	s.l.Lock()
+	s.discarded = true
+	s.l.Unlock()
+	for key, a := range s.takeAlbums() {
+		log.Warnf("dropping incomplete album", "album", key, "items", len(a.media), "of", a.size)
+	}
+}
+
+// Close sends albums still waiting for items
+func (s *TelegramStore) Close() error {
+	var errs []error
+	for key, a := range s.takeAlbums() {
+		log.Warnf("sending incomplete album", "album", key, "items", len(a.media), "of", a.size)
+		errs = append(errs, s.sendAlbum(key, a))
+	}
+	return errors.Join(errs...)
+}
+
+func toMedia(i *commons.Item) telegram.Media {
+	name := i.FileName
+	if name == "" {
+		name = i.Id + "." + i.Ext
+	}
+	m := telegram.Media{Name: name, Path: i.Path, Kind: telegram.MediaDocument}
+	switch {
+	case i.Type == commons.VID_TYPE:
+		m.Kind = telegram.MediaVideo
+	case i.Type == commons.IMG_TYPE && !strings.EqualFold(i.Ext, "gif"):
+		m.Kind = telegram.MediaPhoto
+	}
+	return m
 }
 
 func (t TelegramDstPath) GetBasePath() string {
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/shivamhw/content-pirate/commons"
+	"github.com/shivamhw/content-pirate/pkg/telegram"
+)
+
+func TestToMedia(t *testing.T) {
+	cases := []struct {
+		i    commons.Item
+		name string
+		kind telegram.MediaKind
+	}{
+		{commons.Item{Id: "a", Type: commons.IMG_TYPE, Ext: "jpg"}, "a.jpg", telegram.MediaPhoto},
+		{commons.Item{Id: "b", Type: commons.IMG_TYPE, Ext: "GIF"}, "b.GIF", telegram.MediaDocument},
+		{commons.Item{Id: "c", Type: commons.VID_TYPE, Ext: "mp4", FileName: "clip.mp4"}, "clip.mp4", telegram.MediaVideo},
+	}
+	for _, c := range cases {
+		m := toMedia(&c.i)
+		if m.Name != c.name || m.Kind != c.kind {
+			t.Errorf("%s: expected %s of kind %d, found %s of kind %d", c.i.Id, c.name, c.kind, m.Name, m.Kind)
+		}
+	}
+}
+
+// fakeSender records sent albums, uploaded media carry the item index as id
+type fakeSender struct {
+	l      sync.Mutex
+	albums [][]int64
+}
+
+func (f *fakeSender) UploadAlbumItem(_ string, m telegram.Media) (telegram.UploadedMedia, error) {
+	var n int64
+	fmt.Sscanf(m.Name, "%d.jpg", &n)
+	return &tg.InputMediaPhoto{ID: &tg.InputPhoto{ID: n}}, nil
+}
+
+func (f *fakeSender) SendAlbum(_ string, _ string, media []telegram.UploadedMedia) ([]*tg.Message, error) {
+	defer f.l.Unlock()
+	f.l.Lock()
+	var ids []int64
+	for _, m := range media {
+		ids = append(ids, m.(*tg.InputMediaPhoto).ID.(*tg.InputPhoto).ID)
+	}
+	f.albums = append(f.albums, ids)
+	return nil, nil
+}
+
+func albumItem(n int, size int) *commons.Item {
+	return &commons.Item{
+		Id:        fmt.Sprintf("%d", n),
+		SourceAc:  "pics",
+		Type:      commons.IMG_TYPE,
+		Ext:       "jpg",
+		Path:      "content",
+		GroupId:   "g",
+		GroupSize: size,
+		GroupIdx:  n,
+	}
+}
+
+func TestAlbumWithFewerWorkers(t *testing.T) {
+	up := &fakeSender{}
+	s := &TelegramStore{cfg: &TelegramDstPath{ChatId: 1}, up: up, albums: make(map[string]*album)}
+	const size, workers = 5, 2
+	q := make(chan *commons.Item)
+	done := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range q {
+				if _, err := s.Write(i); err != nil {
+					t.Errorf("writing %s failed %s", i.Id, err)
+				}
+			}
+		}()
+	}
+	go func() {
+		// last index first, album is sent only once every item is in
+		for n := size - 1; n >= 0; n-- {
+			q <- albumItem(n, size)
+		}
+		close(q)
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("album writes blocked workers")
+	}
+	if len(up.albums) != 1 || !slices.Equal(up.albums[0], []int64{0, 1, 2, 3, 4}) {
+		t.Fatalf("expected one album in gallery order, found %v", up.albums)
+	}
+
+	// album missing items is sent on close
+	for n := range 2 {
+		if _, err := s.Write(albumItem(n, size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(up.albums) != 1 {
+		t.Fatalf("expected incomplete album to wait, found %v", up.albums)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(up.albums) != 2 || !slices.Equal(up.albums[1], []int64{0, 1}) {
+		t.Fatalf("expected incomplete album sent on close, found %v", up.albums)
+	}
+}
+
+func TestDiscardDropsAlbums(t *testing.T) {
+	up := &fakeSender{}
+	s := &TelegramStore{cfg: &TelegramDstPath{ChatId: 1}, up: up, albums: make(map[string]*album)}
+	for n := range 2 {
+		if _, err := s.Write(albumItem(n, 3)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Discard()
+	if _, err := s.Write(albumItem(2, 3)); err == nil {
+		t.Fatalf("expected album item after discard to fail")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(up.albums) != 0 {
+		t.Fatalf("expected no album sent after discard, found %v", up.albums)
+	}
+}
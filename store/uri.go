@@ -0,0 +1,204 @@
+package store
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SchemeParser builds the DstPath of a dst uri
+type SchemeParser func(u *url.URL) (DstPath, error)
+
+var (
+	schemes  = make(map[string]SchemeParser)
+	schemesL sync.RWMutex
+)
+
+func init() {
+	RegisterScheme("file", parseFileURI)
+	RegisterScheme("telegram", parseTelegramURI)
+	RegisterScheme("archive", parseArchiveURI)
+	RegisterScheme("s3", parseS3URI)
+	RegisterScheme("webdav", parseWebDAVURI)
+	RegisterScheme("webdavs", parseWebDAVURI)
+}
+
+// RegisterScheme adds parser of dst uris with scheme, stores registered
+// with Register can be reached from the cli this way
+func RegisterScheme(scheme string, f SchemeParser) {
+	defer schemesL.Unlock()
+	schemesL.Lock()
+	schemes[strings.ToLower(scheme)] = f
+}
+
+// ParseDst parses a dst uri like file:///data/pics or telegram://<chatId>,
+// uris without scheme are paths of a file dst
+func ParseDst(uri string) (DstPath, error) {
+	if !strings.Contains(uri, "://") {
+		return FileDstPath{BasePath: uri}, nil
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("parsing dst %s failed %w", uri, err)
+	}
+	schemesL.RLock()
+	f, ok := schemes[strings.ToLower(u.Scheme)]
+	schemesL.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown dst scheme %s in %s", u.Scheme, uri)
+	}
+	d, err := f(u)
+	if err != nil {
+		return nil, fmt.Errorf("parsing dst %s failed %w", u.Redacted(), err)
+	}
+	return d, nil
+}
+
+// ParseDsts parses every uri of a repeated --dst flag
+func ParseDsts(uris []string) ([]DstPath, error) {
+	dsts := make([]DstPath, 0, len(uris))
+	for _, uri := range uris {
+		d, err := ParseDst(uri)
+		if err != nil {
+			return nil, err
+		}
+		dsts = append(dsts, d)
+	}
+	return dsts, nil
+}
+
+// uriPath is the path of file like uris, file://./download is relative
+func uriPath(u *url.URL) string {
+	if u.Host != "" {
+		return u.Host + u.Path
+	}
+	return u.Path
+}
+
+func queryBool(q url.Values, key string) (bool, error) {
+	if !q.Has(key) {
+		return false, nil
+	}
+	if q.Get(key) == "" {
+		return true, nil
+	}
+	return strconv.ParseBool(q.Get(key))
+}
+
+// file:///data/pics?path-format=...&sidecar&index&clean
+func parseFileURI(u *url.URL) (DstPath, error) {
+	q := u.Query()
+	d := FileDstPath{
+		BasePath:   uriPath(u),
+		PathFormat: q.Get("path-format"),
+	}
+	var err error
+	if d.Sidecar, err = queryBool(q, "sidecar"); err != nil {
+		return nil, err
+	}
+	if d.Index, err = queryBool(q, "index"); err != nil {
+		return nil, err
+	}
+	if d.Clean, err = queryBool(q, "clean"); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// telegram://<chatId>?phone=<phone>
+func parseTelegramURI(u *url.URL) (DstPath, error) {
+	id, err := strconv.Atoi(u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("chat id %q is not a number", u.Host)
+	}
+	return TelegramDstPath{ChatId: id, PhoneNumber: u.Query().Get("phone")}, nil
+}
+
+// archive:///data/backup?name=pics&format=tar.gz&max-items=1000&max-bytes=1073741824
+func parseArchiveURI(u *url.URL) (DstPath, error) {
+	q := u.Query()
+	d := ArchiveDstPath{
+		BasePath: uriPath(u),
+		Name:     q.Get("name"),
+		Format:   ArchiveFormat(q.Get("format")),
+	}
+	var err error
+	if q.Has("max-items") {
+		if d.MaxItems, err = strconv.Atoi(q.Get("max-items")); err != nil {
+			return nil, err
+		}
+	}
+	if q.Has("max-bytes") {
+		if d.MaxBytes, err = strconv.ParseInt(q.Get("max-bytes"), 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	if d.Clean, err = queryBool(q, "clean"); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// s3://<access>:<secret>@<bucket>/<prefix>?endpoint=http://localhost:9000&region=&key-format=&content-type=
+// keys are taken from env if not in the uri, AWS is used if endpoint is empty
+func parseS3URI(u *url.URL) (DstPath, error) {
+	q := u.Query()
+	d := S3DstPath{
+		Endpoint:    q.Get("endpoint"),
+		Region:      q.Get("region"),
+		Bucket:      u.Host,
+		KeyFormat:   q.Get("key-format"),
+		ContentType: q.Get("content-type"),
+	}
+	if u.User != nil {
+		d.AccessKey = u.User.Username()
+		d.SecretKey, _ = u.User.Password()
+	}
+	if d.Endpoint == "" {
+		region := d.Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		d.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	if prefix := strings.Trim(u.Path, "/"); prefix != "" {
+		format := d.KeyFormat
+		if format == "" {
+			format = defaultKeyFormat
+		}
+		d.KeyFormat = prefix + "/" + format
+	}
+	if q.Has("part-size") {
+		var err error
+		if d.PartSize, err = strconv.ParseInt(q.Get("part-size"), 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// webdav://<user>:<pass>@nas.local/dav/media?auth=digest&path-format=..., webdavs
+// for https. Credentials are moved out of URL so they are not kept with the
+// job, WEBDAV_USER and WEBDAV_PASSWORD are used if not in the uri.
+func parseWebDAVURI(u *url.URL) (DstPath, error) {
+	q := u.Query()
+	base := *u
+	base.Scheme = "http"
+	if strings.EqualFold(u.Scheme, "webdavs") {
+		base.Scheme = "https"
+	}
+	base.RawQuery = ""
+	base.User = nil
+	d := WebDAVDstPath{
+		URL:        base.String(),
+		Auth:       WebDAVAuth(q.Get("auth")),
+		PathFormat: q.Get("path-format"),
+	}
+	if u.User != nil {
+		d.User = u.User.Username()
+		d.Password, _ = u.User.Password()
+	}
+	return d, nil
+}
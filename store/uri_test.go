@@ -0,0 +1,38 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDst(t *testing.T) {
+	cases := map[string]DstPath{
+		"./download":                                   FileDstPath{BasePath: "./download"},
+		"file:///data/pics?sidecar&index=false":        FileDstPath{BasePath: "/data/pics", Sidecar: true},
+		"file://./download?path-format={{.Id}}":        FileDstPath{BasePath: "./download", PathFormat: "{{.Id}}"},
+		"telegram://1234?phone=%2B911234567890":        TelegramDstPath{ChatId: 1234, PhoneNumber: "+911234567890"},
+		"archive:///backup?format=tar.gz&max-items=10": ArchiveDstPath{BasePath: "/backup", Format: ARCHIVE_TARGZ, MaxItems: 10},
+		"s3://key:secret@media/pics?endpoint=http://localhost:9000": S3DstPath{
+			Endpoint:  "http://localhost:9000",
+			Bucket:    "media",
+			AccessKey: "key",
+			SecretKey: "secret",
+			KeyFormat: "pics/" + defaultKeyFormat,
+		},
+		"webdavs://me:pw@nas.local/dav?auth=digest": WebDAVDstPath{URL: "https://nas.local/dav", User: "me", Password: "pw", Auth: WEBDAV_AUTH_DIGEST},
+	}
+	for uri, want := range cases {
+		got, err := ParseDst(uri)
+		if err != nil {
+			t.Fatalf("%s: %v", uri, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: expected %+v, found %+v", uri, want, got)
+		}
+	}
+	for _, uri := range []string{"ftp://host/path", "telegram://chat"} {
+		if _, err := ParseDst(uri); err == nil {
+			t.Fatalf("%s: expected error", uri)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package store
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/shivamhw/content-pirate/commons"
+	"github.com/shivamhw/content-pirate/pkg/log"
+)
+
+type WebDAVAuth string
+
+const (
+	WEBDAV_AUTH_ANY    WebDAVAuth = "" // scheme asked for by the server
+	WEBDAV_AUTH_BASIC  WebDAVAuth = "basic"
+	WEBDAV_AUTH_DIGEST WebDAVAuth = "digest"
+)
+
+// WebDAVDstPath uploads items under URL of a webdav share, credentials can
+// also be given as user info of URL. Password is not kept with the job,
+// WEBDAV_USER and WEBDAV_PASSWORD are used if it is empty.
+type WebDAVDstPath struct {
+	URL        string // e.g. https://nas.local/remote.php/dav/files/me/media
+	User       string
+	Password   string `json:"-"`
+	Auth       WebDAVAuth
+	PathFormat string // text/template of item path under URL, SourceAc/FileName if empty
+}
+
+func (w WebDAVDstPath) GetBasePath() string {
+	u, err := url.Parse(w.URL)
+	if err != nil {
+		return w.URL
+	}
+	return u.Redacted()
+}
+
+func (w WebDAVDstPath) CleanOnStart() bool {
+	return false
+}
+
+func (w WebDAVDstPath) Type() DstPathType {
+	return WEBDAV_DST_PATH
+}
+
+func (w *WebDAVDstPath) sanitize() (*url.URL, error) {
+	u, err := url.Parse(w.URL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("webdav url must be http or https, found %s", w.URL)
+	}
+	if u.User != nil {
+		if w.User == "" {
+			w.User = u.User.Username()
+		}
+		if p, ok := u.User.Password(); ok && w.Password == "" {
+			w.Password = p
+		}
+		u.User = nil
+	}
+	if w.User == "" {
+		w.User = os.Getenv("WEBDAV_USER")
+	}
+	if w.Password == "" {
+		w.Password = os.Getenv("WEBDAV_PASSWORD")
+	}
+	if w.Auth != WEBDAV_AUTH_ANY && w.Auth != WEBDAV_AUTH_BASIC && w.Auth != WEBDAV_AUTH_DIGEST {
+		return nil, fmt.Errorf("unknown webdav auth %s", w.Auth)
+	}
+	if w.PathFormat == "" {
+		w.PathFormat = defaultKeyFormat
+	}
+	return u, nil
+}
+
+type WebDAVStore struct {
+	cfg  *WebDAVDstPath
+	base *url.URL
+	tpl  *template.Template
+	c    *http.Client
+	dirs sync.Map // collections known to exist
+
+	l      sync.Mutex
+	scheme WebDAVAuth // scheme in use once the server challenged us
+	digest *digestChallenge
+}
+
+func NewWebDAVStore(cfg *WebDAVDstPath) (*WebDAVStore, error) {
+	base, err := cfg.sanitize()
+	if err != nil {
+		return nil, err
+	}
+	tpl, err := parsePathFormat(cfg.PathFormat)
+	if err != nil {
+		return nil, err
+	}
+	s := &WebDAVStore{
+		cfg:  cfg,
+		base: base,
+		tpl:  tpl,
+		c:    &http.Client{Timeout: 10 * time.Minute},
+	}
+	if cfg.Auth == WEBDAV_AUTH_BASIC {
+		s.scheme = WEBDAV_AUTH_BASIC
+	}
+	return s, nil
+}
+
+func (s *WebDAVStore) Write(i *commons.Item) (string, error) {
+	rel, err := s.itemPath(i)
+	if err != nil {
+		return "", err
+	}
+	if dir := path.Dir(rel); dir != "." {
+		if err := s.CreateDir(dir); err != nil {
+			return "", err
+		}
+	}
+	info, err := os.Stat(i.Path)
+	if err != nil {
+		return "", err
+	}
+	body := func() (io.ReadCloser, error) {
+		return os.Open(i.Path)
+	}
+	h := http.Header{}
+	ct := mime.TypeByExtension("." + i.Ext)
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	h.Set("Content-Type", ct)
+	resp, err := s.do(itemCtx(i), http.MethodPut, s.url(rel, false), h, body, info.Size())
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("webdav put %s returned %s", rel, resp.Status)
+	}
+	log.Debugf("uploaded file", "url", s.cfg.GetBasePath(), "path", rel, "size", info.Size())
+	return s.url(rel, false), nil
+}
+
+// ItemExists asks for properties of item, servers which don't allow
+// PROPFIND are asked with HEAD
+func (s *WebDAVStore) ItemExists(i *commons.Item) bool {
+	rel, err := s.itemPath(i)
+	if err != nil {
+		return false
+	}
+	return s.PathExists(s.url(rel, false))
+}
+
+// PathExists checks an url returned by Write
+func (s *WebDAVStore) PathExists(u string) bool {
+	h := http.Header{}
+	h.Set("Depth", "0")
+	resp, err := s.do(context.Background(), "PROPFIND", u, h, nil, 0)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusMultiStatus, http.StatusOK:
+		return true
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		resp, err = s.do(context.Background(), http.MethodHead, u, nil, nil, 0)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode/100 == 2
+	}
+	return false
+}
+
+func (s *WebDAVStore) GetItemDstPath(i *commons.Item) string {
+	return s.cfg.GetBasePath()
+}
+
+// CreateDir creates collection d relative to URL along with its parents
+func (s *WebDAVStore) CreateDir(d string) error {
+	d = strings.Trim(path.Clean("/"+d), "/")
+	if d == "" {
+		return nil
+	}
+	if _, ok := s.dirs.Load(d); ok {
+		return nil
+	}
+	if parent := path.Dir(d); parent != "." {
+		if err := s.CreateDir(parent); err != nil {
+			return err
+		}
+	}
+	resp, err := s.do(context.Background(), "MKCOL", s.url(d, true), nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	// 405 is returned for collections which already exist
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusMethodNotAllowed {
+		return fmt.Errorf("webdav mkcol %s returned %s", d, resp.Status)
+	}
+	s.dirs.Store(d, true)
+	return nil
+}
+
+func (s *WebDAVStore) CleanAll(d string) error {
+	return nil
+}
+
+func (s *WebDAVStore) ID() string {
+	return s.cfg.GetBasePath()
+}
+
+func (s *WebDAVStore) itemPath(i *commons.Item) (string, error) {
+	rel, err := renderPath(s.tpl, i)
+	if err != nil {
+		return "", err
+	}
+	return path.Clean(strings.ReplaceAll(rel, "\\", "/")), nil
+}
+
+// url is address of rel under base, collections end with a slash
+func (s *WebDAVStore) url(rel string, dir bool) string {
+	segs := strings.Split(rel, "/")
+	for n := range segs {
+		segs[n] = url.PathEscape(segs[n])
+	}
+	if dir {
+		segs[len(segs)-1] += "/"
+	}
+	return s.base.JoinPath(segs...).String()
+}
+
+// do sends request, answering an auth challenge of the server once. body
+// is opened again for the retry.
+func (s *WebDAVStore) do(ctx context.Context, method, u string, h http.Header, body func() (io.ReadCloser, error), size int64) (*http.Response, error) {
+	send := func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range h {
+			req.Header[k] = v
+		}
+		if body != nil {
+			if req.Body, err = body(); err != nil {
+				return nil, err
+			}
+			req.ContentLength = size
+		}
+		s.authorize(req)
+		return s.c.Do(req)
+	}
+	resp, err := send()
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || s.cfg.User == "" {
+		return resp, err
+	}
+	if !s.challenged(resp.Header.Values("WWW-Authenticate")) {
+		return resp, nil
+	}
+	resp.Body.Close()
+	return send()
+}
+
+func (s *WebDAVStore) authorize(req *http.Request) {
+	defer s.l.Unlock()
+	s.l.Lock()
+	switch s.scheme {
+	case WEBDAV_AUTH_BASIC:
+		req.SetBasicAuth(s.cfg.User, s.cfg.Password)
+	case WEBDAV_AUTH_DIGEST:
+		req.Header.Set("Authorization", s.digest.authorize(req.Method, req.URL.RequestURI(), s.cfg.User, s.cfg.Password))
+	}
+}
+
+// challenged picks the scheme to answer the challenges of a 401 with, false
+// if none of them is allowed by Auth
+func (s *WebDAVStore) challenged(challenges []string) bool {
+	defer s.l.Unlock()
+	s.l.Lock()
+	for _, c := range challenges {
+		scheme, params, _ := strings.Cut(c, " ")
+		switch {
+		case strings.EqualFold(scheme, "digest") && s.cfg.Auth != WEBDAV_AUTH_BASIC:
+			d := parseDigestChallenge(params)
+			if d.algorithm != "" && !strings.EqualFold(d.algorithm, "MD5") {
+				continue
+			}
+			s.scheme, s.digest = WEBDAV_AUTH_DIGEST, d
+			return true
+		case strings.EqualFold(scheme, "basic") && s.cfg.Auth != WEBDAV_AUTH_DIGEST:
+			if s.scheme == WEBDAV_AUTH_BASIC {
+				// credentials were already sent and rejected
+				return false
+			}
+			s.scheme = WEBDAV_AUTH_BASIC
+			return true
+		}
+	}
+	return false
+}
+
+// digestChallenge answers a digest challenge of RFC 7616 with MD5
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	nc        int
+}
+
+func parseDigestChallenge(params string) *digestChallenge {
+	d := &digestChallenge{}
+	for _, p := range splitParams(params) {
+		k, v, _ := strings.Cut(p, "=")
+		v = strings.Trim(strings.TrimSpace(v), `"`)
+		switch strings.ToLower(strings.TrimSpace(k)) {
+		case "realm":
+			d.realm = v
+		case "nonce":
+			d.nonce = v
+		case "opaque":
+			d.opaque = v
+		case "algorithm":
+			d.algorithm = v
+		case "qop":
+			for _, q := range strings.Split(v, ",") {
+				if strings.TrimSpace(q) == "auth" {
+					d.qop = "auth"
+				}
+			}
+		}
+	}
+	return d
+}
+
+// splitParams splits comma separated params, commas inside quotes are kept
+func splitParams(s string) (params []string) {
+	quoted, start := false, 0
+	for n, c := range s {
+		switch c {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				params = append(params, s[start:n])
+				start = n + 1
+			}
+		}
+	}
+	return append(params, s[start:])
+}
+
+// authorize is the Authorization header of a request, callers serialize
+// calls as nonce count is incremented
+func (d *digestChallenge) authorize(method, uri, user, password string) string {
+	ha1 := md5Hex(user + ":" + d.realm + ":" + password)
+	ha2 := md5Hex(method + ":" + uri)
+	var b strings.Builder
+	fmt.Fprintf(&b, `Digest username="%s", realm="%s", nonce="%s", uri="%s"`, user, d.realm, d.nonce, uri)
+	if d.qop == "" {
+		fmt.Fprintf(&b, `, response="%s"`, md5Hex(ha1+":"+d.nonce+":"+ha2))
+	} else {
+		d.nc++
+		nc := fmt.Sprintf("%08x", d.nc)
+		cnonce := make([]byte, 8)
+		rand.Read(cnonce)
+		cn := hex.EncodeToString(cnonce)
+		resp := md5Hex(ha1 + ":" + d.nonce + ":" + nc + ":" + cn + ":" + d.qop + ":" + ha2)
+		fmt.Fprintf(&b, `, qop=%s, nc=%s, cnonce="%s", response="%s"`, d.qop, nc, cn, resp)
+	}
+	if d.opaque != "" {
+		fmt.Fprintf(&b, `, opaque="%s"`, d.opaque)
+	}
+	if d.algorithm != "" {
+		fmt.Fprintf(&b, `, algorithm=%s`, d.algorithm)
+	}
+	return b.String()
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}